@@ -0,0 +1,114 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/audit"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/farm"
+	"github.com/DevonFarm/sales/horse"
+	"github.com/DevonFarm/sales/user"
+)
+
+// Export writes a zip archive to w holding everything we store about u:
+// their profile, farm, horses and audit history, one JSON file each.
+func Export(ctx context.Context, db *database.DB, u *user.User, w io.Writer) error {
+	files := map[string]any{
+		"profile.json": u,
+	}
+	if u.FarmID != uuid.Nil {
+		f, err := farm.GetFarm(ctx, db, u.FarmID.String())
+		if err != nil {
+			return fmt.Errorf("failed to get farm: %w", err)
+		}
+		files["farm.json"] = f
+		horses, err := horse.GetHorsesByFarmID(ctx, db, u.FarmID, horse.Filter{Status: horse.StatusAll})
+		if err != nil {
+			return fmt.Errorf("failed to get horses: %w", err)
+		}
+		files["horses.json"] = horses
+	}
+	events, err := audit.GetEventsByUserID(ctx, db, u.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get audit events: %w", err)
+	}
+	files["audit_events.json"] = events
+
+	zw := zip.NewWriter(w)
+	for name, data := range files {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to export: %w", name, err)
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+	return nil
+}
+
+// Delete removes u from the database. If u has a farm it is handed over to
+// transferTo, or deleted along with its horses when transferTo is nil.
+// Removing the user from the auth provider is queued as a job in the same
+// transaction, so it only happens once the deletion has committed and is
+// retried until the provider accepts it.
+func Delete(ctx context.Context, db *database.DB, u *user.User, transferTo *user.User) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if u.FarmID != uuid.Nil {
+		if transferTo != nil {
+			_, err := tx.Exec(
+				ctx,
+				`UPDATE users SET farm_id = $1, updated_at = now() WHERE id = $2`,
+				u.FarmID,
+				transferTo.ID,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to transfer farm: %w", err)
+			}
+			if err := farm.EnqueueTransferNotice(ctx, tx, u.FarmID, u, transferTo); err != nil {
+				return err
+			}
+		} else {
+			// Their photos and documents live outside the database
+			if err := horse.EnqueueFarmBlobDeletion(ctx, tx, u.FarmID); err != nil {
+				return err
+			}
+			// Detach any other members first; horses go with the farm
+			// through ON DELETE CASCADE
+			_, err := tx.Exec(ctx, `UPDATE users SET farm_id = NULL WHERE farm_id = $1`, u.FarmID)
+			if err != nil {
+				return fmt.Errorf("failed to detach farm members: %w", err)
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM farms WHERE id = $1`, u.FarmID); err != nil {
+				return fmt.Errorf("failed to delete farm: %w", err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, u.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if err := enqueueIdentityDeletion(ctx, tx, u); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit account deletion: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package account
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/user"
+)
+
+const DeleteIdentityJob = "account.delete_identity"
+
+type deleteIdentity struct {
+	StytchID string `json:"stytch_id"`
+}
+
+// RegisterJobs registers the handlers for the account package's jobs.
+func RegisterJobs(q *jobs.Queue, a *auth.StytchAuth) {
+	q.Handle(DeleteIdentityJob, deleteStytchUser(a))
+}
+
+// enqueueIdentityDeletion queues removing u from the auth provider. It is
+// queued in the account deletion's transaction so it never runs for an
+// account that still exists.
+func enqueueIdentityDeletion(ctx context.Context, db jobs.Execer, u *user.User) error {
+	return jobs.Enqueue(
+		ctx,
+		db,
+		DeleteIdentityJob,
+		fmt.Sprintf("delete-identity:%s", u.StytchID),
+		deleteIdentity{StytchID: u.StytchID},
+	)
+}
+
+func deleteStytchUser(a *auth.StytchAuth) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p deleteIdentity
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		return a.DeleteUser(ctx, p.StytchID)
+	}
+}
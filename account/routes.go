@@ -0,0 +1,120 @@
+package account
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/audit"
+	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/user"
+)
+
+func RegisterRoutes(app *fiber.App, db *database.DB, auth *auth.StytchAuth) {
+	accountGroup := app.Group("/account", auth.RequireAuth(), auth.RequireUser(db))
+	accountGroup.Get("/export", exportData(db))
+	accountGroup.Get("/delete", deleteForm)
+	accountGroup.Post("/delete", deleteAccount(db, auth))
+}
+
+func exportData(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		u := c.Locals("user").(*user.User)
+
+		var buf bytes.Buffer
+		if err := Export(c.UserContext(), db, u, &buf); err != nil {
+			return apperr.Internal("failed to export account data", err)
+		}
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionDataExported,
+			UserID: u.ID,
+			FarmID: u.FarmID,
+		})
+
+		c.Attachment("devon-farm-export.zip")
+		c.Set(fiber.HeaderContentType, "application/zip")
+		return c.Send(buf.Bytes())
+	}
+}
+
+func deleteForm(c *fiber.Ctx) error {
+	return c.Render("templates/account_delete", fiber.Map{
+		"Title": "Delete Account",
+		"User":  c.Locals("user"),
+	})
+}
+
+func deleteAccount(db *database.DB, auth *auth.StytchAuth) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		u := c.Locals("user").(*user.User)
+		if c.Locals("impersonator") != nil {
+			return apperr.Forbidden("accounts cannot be deleted while impersonating")
+		}
+		renderError := func(msg string) error {
+			return c.Status(fiber.StatusBadRequest).Render("templates/account_delete", fiber.Map{
+				"Title": "Delete Account",
+				"User":  u,
+				"Error": msg,
+			})
+		}
+
+		if !strings.EqualFold(strings.TrimSpace(c.FormValue("confirm_email")), u.Email) {
+			return renderError("Type your email address to confirm")
+		}
+
+		// Decide what happens to the farm before anything is deleted
+		var transferTo *user.User
+		if u.FarmID != uuid.Nil {
+			switch c.FormValue("farm_action") {
+			case "transfer":
+				email := strings.TrimSpace(c.FormValue("transfer_email"))
+				target, err := user.GetUserByEmail(c.UserContext(), db, email)
+				if err != nil {
+					return apperr.Internal("failed to get user by email", err)
+				}
+				if target == nil || target.ID == u.ID {
+					return renderError("No other user found with that email")
+				}
+				if target.FarmID != uuid.Nil && target.FarmID != u.FarmID {
+					return renderError("That user already has a farm of their own")
+				}
+				transferTo = target
+			case "delete":
+			default:
+				return renderError("Choose whether to transfer or delete your farm")
+			}
+		}
+
+		if err := Delete(c.UserContext(), db, u, transferTo); err != nil {
+			return apperr.Internal("failed to delete account", err)
+		}
+
+		if transferTo != nil {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionFarmTransferred,
+				UserID: u.ID,
+				FarmID: u.FarmID,
+				Detail: fmt.Sprintf("transferred to user %s", transferTo.ID),
+			})
+		} else if u.FarmID != uuid.Nil {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionFarmDeleted,
+				UserID: u.ID,
+				FarmID: u.FarmID,
+			})
+		}
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionAccountDeleted,
+			UserID: u.ID,
+			FarmID: u.FarmID,
+		})
+
+		auth.ClearSession(c)
+		return c.Redirect("/")
+	}
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+)
+
+type FarmSummary struct {
+	ID         uuid.UUID `db:"id"`
+	Name       string    `db:"name"`
+	CreatedAt  time.Time `db:"created_at"`
+	UserCount  int       `db:"user_count"`
+	HorseCount int       `db:"horse_count"`
+}
+
+type UserSummary struct {
+	ID         uuid.UUID  `db:"id"`
+	Name       string     `db:"name"`
+	Email      string     `db:"email"`
+	FarmID     uuid.UUID  `db:"farm_id"`
+	FarmName   string     `db:"farm_name"`
+	IsAdmin    bool       `db:"is_admin"`
+	DisabledAt *time.Time `db:"disabled_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+func GetFarmSummaries(ctx context.Context, db *database.DB) ([]*FarmSummary, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT f.id, f.name, f.created_at,
+			(SELECT COUNT(*) FROM users u WHERE u.farm_id = f.id) AS user_count,
+			(SELECT COUNT(*) FROM horses h WHERE h.farm_id = f.id) AS horse_count
+		FROM farms f ORDER BY f.name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query farms: %w", err)
+	}
+	farms, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[FarmSummary])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect farms: %w", err)
+	}
+	return farms, nil
+}
+
+func GetUserSummaries(ctx context.Context, db *database.DB) ([]*UserSummary, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT u.id, u.name, u.email, u.farm_id, COALESCE(f.name, '') AS farm_name,
+			u.is_admin, u.disabled_at, u.created_at
+		FROM users u LEFT JOIN farms f ON f.id = u.farm_id ORDER BY u.email`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[UserSummary])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect users: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,216 @@
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/audit"
+	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/logging"
+	"github.com/DevonFarm/sales/schedule"
+	"github.com/DevonFarm/sales/user"
+)
+
+func RegisterRoutes(app *fiber.App, db *database.DB, auth *auth.StytchAuth) {
+	adminGroup := app.Group("/admin", auth.RequireAuth(), auth.RequireAdmin(db))
+	adminGroup.Get("/", getConsole(db))
+	adminGroup.Post("/user/:id/disable", setUserDisabled(db, auth, true))
+	adminGroup.Post("/user/:id/enable", setUserDisabled(db, auth, false))
+	adminGroup.Post("/user/:id/impersonate", startImpersonation(db, auth))
+	adminGroup.Post("/impersonation/stop", stopImpersonation(db, auth))
+	adminGroup.Post("/job/:id/retry", retryJob(db))
+}
+
+const (
+	// deadJobLimit caps how many dead-lettered jobs the console lists
+	deadJobLimit = 50
+	// taskRunLimit caps how many recent scheduled task runs are listed
+	taskRunLimit = 20
+)
+
+func getConsole(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		farms, err := GetFarmSummaries(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get farms", err)
+		}
+		users, err := GetUserSummaries(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get users", err)
+		}
+		jobStats, err := jobs.GetStats(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get job stats", err)
+		}
+		deadJobs, err := jobs.GetDeadJobs(c.UserContext(), db, deadJobLimit)
+		if err != nil {
+			return apperr.Internal("failed to get dead jobs", err)
+		}
+		tasks, err := schedule.GetTaskStatuses(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get scheduled tasks", err)
+		}
+		taskRuns, err := schedule.GetRecentRuns(c.UserContext(), db, taskRunLimit)
+		if err != nil {
+			return apperr.Internal("failed to get task runs", err)
+		}
+		return c.Render("templates/admin", fiber.Map{
+			"Title":    "Admin",
+			"Farms":    farms,
+			"Users":    users,
+			"JobStats": jobStats,
+			"DeadJobs": deadJobs,
+			"Tasks":    tasks,
+			"TaskRuns": taskRuns,
+		})
+	}
+}
+
+func setUserDisabled(db *database.DB, a *auth.StytchAuth, disabled bool) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		admin := c.Locals("admin").(*user.User)
+		u, err := user.GetUser(c.UserContext(), db, c.Params("id"))
+		if err != nil {
+			return apperr.Validation("invalid user ID")
+		}
+		if u == nil {
+			return apperr.NotFound("user not found")
+		}
+		if u.ID == admin.ID {
+			return apperr.Validation("admins cannot disable themselves")
+		}
+
+		if err := u.SetDisabled(c.UserContext(), db, disabled); err != nil {
+			return apperr.Internal("failed to update user", err)
+		}
+		action := audit.ActionAccountEnabled
+		if disabled {
+			action = audit.ActionAccountDisabled
+		}
+		audit.Record(c, db, audit.Event{
+			Action: action,
+			UserID: admin.ID,
+			FarmID: u.FarmID,
+			Detail: fmt.Sprintf("user %s (%s)", u.ID, u.Email),
+		})
+
+		if disabled {
+			// Log them out everywhere rather than waiting for the next request
+			n, err := a.RevokeSessions(c.UserContext(), u.StytchID)
+			if err != nil {
+				logging.From(c).Warn("failed to revoke sessions for disabled user", "disabled_user_id", u.ID, "error", err)
+			}
+			if n > 0 {
+				audit.Record(c, db, audit.Event{
+					Action: audit.ActionSessionRevoked,
+					UserID: u.ID,
+					FarmID: u.FarmID,
+					Detail: fmt.Sprintf("%d sessions revoked by admin %s", n, admin.ID),
+				})
+			}
+			// Nor may any admin go on acting as them
+			ended, err := auth.EndImpersonationsOf(c.UserContext(), db, u.ID)
+			if err != nil {
+				return apperr.Internal("failed to end impersonations", err)
+			}
+			if ended > 0 {
+				audit.Record(c, db, audit.Event{
+					Action: audit.ActionImpersonationEnded,
+					UserID: admin.ID,
+					FarmID: u.FarmID,
+					Detail: fmt.Sprintf("%d impersonations of user %s ended on disabling", ended, u.ID),
+				})
+			}
+		}
+		return c.Redirect("/admin")
+	}
+}
+
+func startImpersonation(db *database.DB, a *auth.StytchAuth) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		admin := c.Locals("admin").(*user.User)
+		reason := strings.TrimSpace(c.FormValue("reason"))
+		if reason == "" {
+			return apperr.Validation("a reason is required to impersonate a user")
+		}
+		target, err := user.GetUser(c.UserContext(), db, c.Params("id"))
+		if err != nil {
+			return apperr.Validation("invalid user ID")
+		}
+		if target == nil {
+			return apperr.NotFound("user not found")
+		}
+		if target.IsDisabled() {
+			return apperr.Validation("disabled accounts cannot be impersonated")
+		}
+
+		imp, err := auth.StartImpersonation(c.UserContext(), db, admin.ID, target.ID, reason)
+		if err != nil {
+			return apperr.Internal("failed to start impersonation", err)
+		}
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionImpersonationStarted,
+			UserID: admin.ID,
+			FarmID: target.FarmID,
+			Detail: fmt.Sprintf("impersonating user %s (%s) until %s: %s",
+				target.ID, target.Email, imp.ExpiresAt.Format("15:04"), reason),
+		})
+		a.SetImpersonation(c, imp)
+
+		if target.HasFarm() {
+			return c.Redirect(fmt.Sprintf("/farm/%s", target.FarmID))
+		}
+		return c.Redirect(fmt.Sprintf("/user/%s/profile", target.ID))
+	}
+}
+
+func stopImpersonation(db *database.DB, a *auth.StytchAuth) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		admin := c.Locals("admin").(*user.User)
+		imp, err := auth.GetActiveImpersonation(c.UserContext(), db, a.ImpersonationCookie(c), admin.ID)
+		if err != nil {
+			return apperr.Internal("failed to get impersonation", err)
+		}
+		if imp != nil {
+			if err := imp.End(c.UserContext(), db); err != nil {
+				return apperr.Internal("failed to end impersonation", err)
+			}
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionImpersonationEnded,
+				UserID: admin.ID,
+				Detail: fmt.Sprintf("stopped impersonating user %s", imp.TargetUserID),
+			})
+		}
+		a.ClearImpersonation(c)
+		return c.Redirect("/admin")
+	}
+}
+
+func retryJob(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		admin := c.Locals("admin").(*user.User)
+		id, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return apperr.Validation("invalid job ID")
+		}
+		ok, err := jobs.Retry(c.UserContext(), db, id)
+		if err != nil {
+			return apperr.Internal("failed to retry job", err)
+		}
+		if !ok {
+			return apperr.NotFound("no dead job with that ID")
+		}
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionJobRetried,
+			UserID: admin.ID,
+			Detail: fmt.Sprintf("job %s", id),
+		})
+		return c.Redirect("/admin")
+	}
+}
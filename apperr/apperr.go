@@ -0,0 +1,115 @@
+package apperr
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+)
+
+// Error is an error a handler can return to have the server's error handler
+// respond with the right status. Message is shown to the user while Err is
+// only logged.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+	// status overrides the code implied by Kind, e.g. for a 405 from Fiber
+	status int
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) StatusCode() int {
+	if e.status != 0 {
+		return e.status
+	}
+	switch e.Kind {
+	case KindValidation:
+		return fiber.StatusBadRequest
+	case KindUnauthorized:
+		return fiber.StatusUnauthorized
+	case KindForbidden:
+		return fiber.StatusForbidden
+	case KindNotFound:
+		return fiber.StatusNotFound
+	case KindConflict:
+		return fiber.StatusConflict
+	}
+	return fiber.StatusInternalServerError
+}
+
+func Validation(message string) *Error {
+	return &Error{Kind: KindValidation, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Kind: KindForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+// Internal hides err from the user behind message.
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// As returns err as an *Error. Errors that are not already typed are
+// treated as internal.
+func As(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fromStatus(fiberErr.Code, fiberErr.Message)
+	}
+	return Internal("something went wrong", err)
+}
+
+func fromStatus(code int, message string) *Error {
+	kind := KindInternal
+	switch {
+	case code == fiber.StatusUnauthorized:
+		kind = KindUnauthorized
+	case code == fiber.StatusForbidden:
+		kind = KindForbidden
+	case code == fiber.StatusNotFound:
+		kind = KindNotFound
+	case code == fiber.StatusConflict:
+		kind = KindConflict
+	case code >= 400 && code < 500:
+		kind = KindValidation
+	}
+	return &Error{Kind: kind, Message: message, status: code}
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/logging"
+)
+
+type Action string
+
+const (
+	ActionLogin            Action = "login"
+	ActionLoginFailed      Action = "login_failed"
+	ActionLogout           Action = "logout"
+	ActionSessionRevoked   Action = "session_revoked"
+	ActionProfileUpdated   Action = "profile_updated"
+	ActionEmailChanged     Action = "email_changed"
+	ActionPermissionDenied Action = "permission_denied"
+	ActionDataExported     Action = "data_exported"
+	ActionAccountDeleted   Action = "account_deleted"
+	ActionFarmTransferred  Action = "farm_transferred"
+	ActionFarmDeleted      Action = "farm_deleted"
+	ActionWatermarkUpdated Action = "watermark_updated"
+	// Admin actions, recorded against the admin with the subject in Detail
+	ActionAccountDisabled      Action = "account_disabled"
+	ActionAccountEnabled       Action = "account_enabled"
+	ActionImpersonationStarted Action = "impersonation_started"
+	ActionImpersonationEnded   Action = "impersonation_ended"
+	ActionJobRetried           Action = "job_retried"
+)
+
+// Event is a single row of the append-only audit_events table. UserID and
+// FarmID are uuid.Nil when the actor or farm is unknown, e.g. for a failed
+// magic link callback.
+type Event struct {
+	ID     uuid.UUID `db:"id"`
+	Action Action    `db:"action"`
+	UserID uuid.UUID `db:"user_id"`
+	// ImpersonatorID is the admin who acted as UserID, or uuid.Nil
+	ImpersonatorID uuid.UUID `db:"impersonator_id"`
+	FarmID         uuid.UUID `db:"farm_id"`
+	Detail         string    `db:"detail"`
+	IP             string    `db:"ip"`
+	UserAgent      string    `db:"user_agent"`
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// Impersonated reports whether an admin acted as the user.
+func (e *Event) Impersonated() bool {
+	return e.ImpersonatorID != uuid.Nil
+}
+
+const eventColumns = `id, action, user_id, impersonator_id, farm_id, detail, ip, user_agent, created_at`
+
+// ImpersonatorLocal is the Locals key holding the uuid.UUID of the admin
+// impersonating the request's user, which Record copies into each event.
+const ImpersonatorLocal = "impersonator_id"
+
+// Insert appends e to the audit log. There is deliberately no way to update
+// or delete an event once it has been written.
+func Insert(ctx context.Context, db *database.DB, e *Event) error {
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO audit_events (action, user_id, farm_id, detail, ip, user_agent, impersonator_id)
+		VALUES ($1, NULLIF($2, $7), NULLIF($3, $7), $4, $5, $6, NULLIF($8, $7))
+		RETURNING id, created_at`,
+		e.Action,         // $1
+		e.UserID,         // $2
+		e.FarmID,         // $3
+		e.Detail,         // $4
+		e.IP,             // $5
+		e.UserAgent,      // $6
+		uuid.Nil,         // $7
+		e.ImpersonatorID, // $8
+	)
+	if err := row.Scan(&e.ID, &e.CreatedAt); err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// Record appends e to the audit log, filling in the client IP, user agent
+// and any impersonating admin from the request. Failures are logged rather
+// than returned so that auditing never breaks the request being audited.
+func Record(c *fiber.Ctx, db *database.DB, e Event) {
+	if id, ok := c.Locals(ImpersonatorLocal).(uuid.UUID); ok && e.ImpersonatorID == uuid.Nil {
+		e.ImpersonatorID = id
+	}
+	// Behind a trusted proxy Fiber resolves this from the configured header
+	e.IP = c.IP()
+	e.UserAgent = c.Get(fiber.HeaderUserAgent)
+	if err := Insert(c.UserContext(), db, &e); err != nil {
+		logging.From(c).Error("failed to record audit event", "action", e.Action, "error", err)
+	}
+}
+
+func GetEventsByFarmID(ctx context.Context, db *database.DB, farmID uuid.UUID, limit int) ([]*Event, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+eventColumns+`
+		FROM audit_events WHERE farm_id = $1 ORDER BY created_at DESC LIMIT $2`,
+		farmID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Event])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect audit events: %w", err)
+	}
+	return events, nil
+}
+
+func GetEventsByUserID(ctx context.Context, db *database.DB, userID uuid.UUID) ([]*Event, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+eventColumns+`
+		FROM audit_events WHERE user_id = $1 ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Event])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect audit events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+)
+
+const (
+	impersonationCookieName = "impersonation_id"
+	// ImpersonationTTL is how long an admin may act as another user before
+	// having to start a new impersonation
+	ImpersonationTTL = 30 * time.Minute
+)
+
+// Impersonation lets an admin see the app as TargetUserID until ExpiresAt
+// or until it is ended.
+type Impersonation struct {
+	ID           uuid.UUID  `db:"id"`
+	AdminID      uuid.UUID  `db:"admin_id"`
+	TargetUserID uuid.UUID  `db:"target_user_id"`
+	Reason       string     `db:"reason"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	EndedAt      *time.Time `db:"ended_at"`
+}
+
+func StartImpersonation(ctx context.Context, db *database.DB, adminID, targetUserID uuid.UUID, reason string) (*Impersonation, error) {
+	imp := &Impersonation{
+		AdminID:      adminID,
+		TargetUserID: targetUserID,
+		Reason:       reason,
+		ExpiresAt:    time.Now().Add(ImpersonationTTL),
+	}
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO impersonations (admin_id, target_user_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`,
+		imp.AdminID,      // $1
+		imp.TargetUserID, // $2
+		imp.Reason,       // $3
+		imp.ExpiresAt,    // $4
+	)
+	if err := row.Scan(&imp.ID); err != nil {
+		return nil, fmt.Errorf("failed to insert impersonation: %w", err)
+	}
+	return imp, nil
+}
+
+// GetActiveImpersonation returns the impersonation with the given ID if it
+// was started by adminID and has neither expired nor been ended.
+func GetActiveImpersonation(ctx context.Context, db *database.DB, id string, adminID uuid.UUID) (*Impersonation, error) {
+	impID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, admin_id, target_user_id, reason, expires_at, ended_at FROM impersonations
+		WHERE id = $1 AND admin_id = $2 AND ended_at IS NULL AND expires_at > $3`,
+		impID,
+		adminID,
+		time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query impersonation: %w", err)
+	}
+	imp, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[Impersonation])
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+	return &imp, nil
+}
+
+func (i *Impersonation) End(ctx context.Context, db *database.DB) error {
+	_, err := db.Exec(
+		ctx,
+		`UPDATE impersonations SET ended_at = now() WHERE id = $1 AND ended_at IS NULL`,
+		i.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to end impersonation: %w", err)
+	}
+	return nil
+}
+
+// EndImpersonationsOf ends every active impersonation of targetUserID and
+// returns how many there were.
+func EndImpersonationsOf(ctx context.Context, db *database.DB, targetUserID uuid.UUID) (int64, error) {
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE impersonations SET ended_at = now() WHERE target_user_id = $1 AND ended_at IS NULL`,
+		targetUserID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to end impersonations: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SetImpersonation makes the admin's following requests act as the
+// impersonated user until the impersonation expires.
+func (a *StytchAuth) SetImpersonation(c *fiber.Ctx, imp *Impersonation) {
+	c.Cookie(&fiber.Cookie{
+		Name:     impersonationCookieName,
+		Value:    imp.ID.String(),
+		Expires:  imp.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   isSecure(c),
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+func (a *StytchAuth) ClearImpersonation(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{Name: impersonationCookieName, Value: "", Expires: time.Unix(0, 0), HTTPOnly: true, Secure: isSecure(c), SameSite: fiber.CookieSameSiteLaxMode, Path: "/"})
+}
+
+// ImpersonationCookie returns the ID of the impersonation the request
+// carries, if any.
+func (a *StytchAuth) ImpersonationCookie(c *fiber.Ctx) string {
+	return c.Cookies(impersonationCookieName)
+}
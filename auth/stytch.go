@@ -4,21 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/log"
 	"github.com/google/uuid"
 	"github.com/stytchauth/stytch-go/v16/stytch/consumer/magiclinks"
 	"github.com/stytchauth/stytch-go/v16/stytch/consumer/magiclinks/email"
 	"github.com/stytchauth/stytch-go/v16/stytch/consumer/sessions"
 	"github.com/stytchauth/stytch-go/v16/stytch/consumer/stytchapi"
+	"github.com/stytchauth/stytch-go/v16/stytch/consumer/users"
+	"github.com/stytchauth/stytch-go/v16/stytch/stytcherror"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/audit"
+	"github.com/DevonFarm/sales/config"
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/logging"
 	"github.com/DevonFarm/sales/user"
-	"github.com/DevonFarm/sales/utils"
 )
 
 const defaultCookieName = "stytch_session_token"
@@ -26,18 +31,20 @@ const defaultCookieName = "stytch_session_token"
 type StytchAuth struct {
 	CookieName string
 	Client     *stytchapi.API
-}
 
-// NewStytchFromEnv creates a Stytch client from environment variables:
-// STYTCH_PROJECT_ID, STYTCH_SECRET
-func NewStytchFromEnv() (*StytchAuth, error) {
-	projectID := os.Getenv("STYTCH_PROJECT_ID")
-	secret := os.Getenv("STYTCH_SECRET")
-	if projectID == "" || secret == "" {
-		return nil, errors.New("missing STYTCH_PROJECT_ID or STYTCH_SECRET env var")
-	}
+	projectID string
+}
 
-	client, err := stytchapi.NewClient(projectID, secret)
+// NewStytch creates a Stytch client from the auth settings.
+func NewStytch(cfg config.AuthConfig) (*StytchAuth, error) {
+	httpClient := &http.Client{Transport: instrumentedTransport{
+		base: otelhttp.NewTransport(http.DefaultTransport),
+	}}
+	client, err := stytchapi.NewClient(
+		cfg.StytchProjectID,
+		cfg.StytchSecret,
+		stytchapi.WithHTTPClient(httpClient),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("stytchapi.NewClient: %w", err)
 	}
@@ -45,15 +52,26 @@ func NewStytchFromEnv() (*StytchAuth, error) {
 	return &StytchAuth{
 		Client:     client,
 		CookieName: defaultCookieName,
+		projectID:  cfg.StytchProjectID,
 	}, nil
 }
 
+// Ping checks that Stytch is reachable by fetching the project's JWKS,
+// which needs no user session.
+func (a *StytchAuth) Ping(ctx context.Context) error {
+	_, err := a.Client.Sessions.GetJWKS(ctx, &sessions.GetJWKSParams{ProjectID: a.projectID})
+	if err != nil {
+		return fmt.Errorf("failed to fetch stytch jwks: %w", err)
+	}
+	return nil
+}
+
 // Register mounts auth routes: GET /login, POST /login, GET /auth/callback, POST /logout
 func (a *StytchAuth) Register(app *fiber.App, db *database.DB) {
 	app.Get("/login", a.renderLogin(db))
 	app.Post("/login", a.sendMagicLink(db))
 	app.Get("/auth/callback", a.magicLinkCallback(db))
-	app.Post("/logout", a.logout)
+	app.Post("/logout", a.logout(db))
 }
 
 // RequireAuth verifies the session token cookie and sets user info in Locals.
@@ -63,13 +81,13 @@ func (a *StytchAuth) RequireAuth() fiber.Handler {
 		if token == "" {
 			return c.Redirect("/login")
 		}
-		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
 		defer cancel()
 		// Authenticate the session token with Stytch
 		res, err := a.Client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{SessionToken: token})
 		if err != nil {
-			c.SendStatus(fiber.StatusUnauthorized)
-			return err
+			a.ClearSession(c)
+			return apperr.Unauthorized("your session has expired, please log in again")
 		}
 		// Refresh the cookie with a new expiration time
 		c.Cookie(&fiber.Cookie{
@@ -85,21 +103,207 @@ func (a *StytchAuth) RequireAuth() fiber.Handler {
 		// Stash user info for handlers/templates
 		c.Locals("stytch_session", res.Session)
 		c.Locals("stytch_user_id", res.Session.UserID)
+		logging.With(c, "stytch_user_id", res.Session.UserID)
+		return c.Next()
+	}
+}
+
+// ErrAccountDisabled is returned when the session belongs to a user an
+// admin has disabled.
+var ErrAccountDisabled = errors.New("account disabled")
+
+// RequireUser must be mounted after RequireAuth. It loads the user the
+// request acts as and stashes it in Locals for handlers.
+func (a *StytchAuth) RequireUser(db *database.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		u, err := a.currentUser(c, db)
+		if err != nil {
+			return a.respondUserError(c, err)
+		}
+		if u == nil {
+			return c.Redirect("/login")
+		}
+		setUser(c, u)
 		return c.Next()
 	}
 }
 
+// RequireFarmOwner must be mounted after RequireAuth. It only lets through
+// users whose farm matches the :farmID route parameter and stashes the
+// user in Locals for handlers.
+func (a *StytchAuth) RequireFarmOwner(db *database.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		u, err := a.currentUser(c, db)
+		if err != nil {
+			return a.respondUserError(c, err)
+		}
+		if u == nil {
+			return c.Redirect("/login")
+		}
+		farmID := c.Params("farmID")
+		if u.FarmID == uuid.Nil || u.FarmID.String() != farmID {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionPermissionDenied,
+				UserID: u.ID,
+				FarmID: u.FarmID,
+				Detail: fmt.Sprintf("%s %s", c.Method(), c.Path()),
+			})
+			return apperr.Forbidden("you do not have access to this farm")
+		}
+		setUser(c, u)
+		return c.Next()
+	}
+}
+
+// RequireAdmin must be mounted after RequireAuth. It only lets through
+// platform admins and is never affected by impersonation.
+func (a *StytchAuth) RequireAdmin(db *database.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		u, err := a.sessionUser(c, db)
+		if err != nil {
+			return a.respondUserError(c, err)
+		}
+		if u == nil {
+			return c.Redirect("/login")
+		}
+		if !u.IsAdmin {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionPermissionDenied,
+				UserID: u.ID,
+				FarmID: u.FarmID,
+				Detail: fmt.Sprintf("%s %s", c.Method(), c.Path()),
+			})
+			return apperr.Forbidden("admins only")
+		}
+		c.Locals("admin", u)
+		logging.With(c, "user_id", u.ID, "farm_id", u.FarmID)
+		return c.Next()
+	}
+}
+
+// RevokeSessions revokes every active Stytch session of the user and
+// returns how many were revoked.
+func (a *StytchAuth) RevokeSessions(ctx context.Context, stytchUserID string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := a.Client.Sessions.Get(ctx, &sessions.GetParams{UserID: stytchUserID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get stytch sessions: %w", err)
+	}
+	for i, s := range res.Sessions {
+		if _, err := a.Client.Sessions.Revoke(ctx, &sessions.RevokeParams{SessionID: s.SessionID}); err != nil {
+			return i, fmt.Errorf("failed to revoke stytch session: %w", err)
+		}
+	}
+	return len(res.Sessions), nil
+}
+
+// DeleteUser removes the user from Stytch, which also invalidates all of
+// their sessions. A user Stytch no longer knows about counts as deleted, so
+// the call is safe to retry.
+func (a *StytchAuth) DeleteUser(ctx context.Context, stytchUserID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := a.Client.Users.Delete(ctx, &users.DeleteParams{UserID: stytchUserID})
+	var stytchErr stytcherror.Error
+	if errors.As(err, &stytchErr) && stytchErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete stytch user: %w", err)
+	}
+	return nil
+}
+
+// ClearSession expires the session cookie on the client.
+func (a *StytchAuth) ClearSession(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{Name: a.CookieName, Value: "", Expires: time.Unix(0, 0), HTTPOnly: true, Secure: isSecure(c), SameSite: fiber.CookieSameSiteLaxMode, Path: "/"})
+}
+
+// currentUser returns the user the request acts as: the session's own user,
+// or the target of an active impersonation started by that user.
+func (a *StytchAuth) currentUser(c *fiber.Ctx, db *database.DB) (*user.User, error) {
+	u, err := a.sessionUser(c, db)
+	if err != nil || u == nil || !u.IsAdmin {
+		return u, err
+	}
+	impID := c.Cookies(impersonationCookieName)
+	if impID == "" {
+		return u, nil
+	}
+	imp, err := GetActiveImpersonation(c.UserContext(), db, impID, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if imp == nil {
+		// Expired or ended, drop back to the admin's own account
+		a.ClearImpersonation(c)
+		return u, nil
+	}
+	target, err := user.GetUser(c.UserContext(), db, imp.TargetUserID.String())
+	if err != nil || target == nil {
+		return u, err
+	}
+	if target.IsDisabled() {
+		// Disabled since it started; nobody may act as a disabled account
+		if err := imp.End(c.UserContext(), db); err != nil {
+			return nil, err
+		}
+		a.ClearImpersonation(c)
+		return u, nil
+	}
+	c.Locals("impersonator", u)
+	c.Locals(audit.ImpersonatorLocal, u.ID)
+	c.Locals("impersonation", imp)
+	return target, nil
+}
+
+// sessionUser returns the user who owns the Stytch session, ignoring any
+// impersonation.
+func (a *StytchAuth) sessionUser(c *fiber.Ctx, db *database.DB) (*user.User, error) {
+	stytchUserID, _ := c.Locals("stytch_user_id").(string)
+	if stytchUserID == "" {
+		return nil, nil
+	}
+	u, err := user.GetUserByStytchID(c.UserContext(), db, stytchUserID)
+	if err != nil || u == nil {
+		return u, err
+	}
+	if u.IsDisabled() {
+		return nil, ErrAccountDisabled
+	}
+	return u, nil
+}
+
+// setUser stashes u for handlers and tags the request's log lines with it.
+func setUser(c *fiber.Ctx, u *user.User) {
+	c.Locals("user", u)
+	attrs := []any{"user_id", u.ID, "farm_id", u.FarmID}
+	if impersonator, ok := c.Locals("impersonator").(*user.User); ok {
+		attrs = append(attrs, "impersonator_id", impersonator.ID)
+	}
+	logging.With(c, attrs...)
+}
+
+func (a *StytchAuth) respondUserError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrAccountDisabled) {
+		a.ClearSession(c)
+		return apperr.Forbidden("this account has been disabled")
+	}
+	return apperr.Internal("failed to get current user", err)
+}
+
 func (a *StytchAuth) renderLogin(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		// If already logged in, skip
 		token := c.Cookies(a.CookieName)
 		if token != "" {
 			// check if session is valid and get farm ID from the user
-			res, err := a.Client.Sessions.Authenticate(c.Context(), &sessions.AuthenticateParams{SessionToken: token})
+			res, err := a.Client.Sessions.Authenticate(c.UserContext(), &sessions.AuthenticateParams{SessionToken: token})
 			if err == nil {
 				stytchUserID := res.Session.UserID
-				u, err := user.GetUserByStytchID(c.Context(), db, stytchUserID)
-				if err == nil && u != nil {
+				u, err := user.GetUserByStytchID(c.UserContext(), db, stytchUserID)
+				if err == nil && u != nil && !u.IsDisabled() {
 					if u.FarmID == uuid.Nil {
 						// No farm yet, go to create farm page
 						return c.Redirect(fmt.Sprintf("/new/farm/%s", u.ID))
@@ -107,10 +311,10 @@ func (a *StytchAuth) renderLogin(db *database.DB) func(*fiber.Ctx) error {
 					// Redirect to the user's farm dashboard
 					return c.Redirect(fmt.Sprintf("/farm/%s", u.FarmID))
 				} else {
-					log.Warnf("user not found for stytch ID %s: %v", stytchUserID, err)
+					logging.From(c).Warn("user not found for stytch ID", "stytch_user_id", stytchUserID, "error", err)
 				}
 			} else {
-				log.Warnf("invalid session token: %v", err)
+				logging.From(c).Warn("invalid session token", "error", err)
 			}
 		}
 		return c.Render("templates/login", fiber.Map{
@@ -123,7 +327,7 @@ func (a *StytchAuth) sendMagicLink(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		var u user.User
 		if err := c.BodyParser(&u); err != nil {
-			return c.Status(fiber.StatusBadRequest).Render("login", fiber.Map{
+			return c.Status(fiber.StatusBadRequest).Render("templates/login", fiber.Map{
 				"Title": "Log in",
 				"Error": "Enter a valid name and email",
 			})
@@ -131,28 +335,21 @@ func (a *StytchAuth) sendMagicLink(db *database.DB) func(*fiber.Ctx) error {
 
 		// Send the magic link via email
 		params := email.LoginOrCreateParams{Email: u.Email}
-		res, err := a.Client.MagicLinks.Email.LoginOrCreate(c.Context(), &params)
+		res, err := a.Client.MagicLinks.Email.LoginOrCreate(c.UserContext(), &params)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("failed to send magic link")
+			return apperr.Internal("failed to send magic link", err)
 		}
-		existingUser, err := user.GetUserByStytchID(c.Context(), db, res.UserID)
+		existingUser, err := user.GetUserByStytchID(c.UserContext(), db, res.UserID)
 		if err != nil {
-			return utils.LogAndRespondError(
-				c,
-				"failed to get user by stytch ID",
-				err,
-				fiber.StatusInternalServerError,
-			)
+			return apperr.Internal("failed to get user by stytch ID", err)
 		}
 		if existingUser == nil {
-			_, err = user.NewUser(c.Context(), db, u.Name, u.Email, res.UserID)
+			newUser, err := user.NewUser(c.UserContext(), db, u.Name, u.Email, res.UserID)
 			if err != nil {
-				return utils.LogAndRespondError(
-					c,
-					"failed to create user",
-					err,
-					fiber.StatusInternalServerError,
-				)
+				return apperr.Internal("failed to create user", err)
+			}
+			if err := user.EnqueueWelcomeEmail(c.UserContext(), db, newUser); err != nil {
+				logging.From(c).Error("failed to enqueue welcome email", "error", err)
 			}
 		}
 
@@ -167,9 +364,13 @@ func (a *StytchAuth) magicLinkCallback(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		token := c.Query("token")
 		if token == "" {
-			return c.Status(fiber.StatusBadRequest).SendString("missing token")
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionLoginFailed,
+				Detail: "missing token",
+			})
+			return apperr.Validation("missing token")
 		}
-		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
 		defer cancel()
 
 		res, err := a.Client.MagicLinks.Authenticate(ctx, &magiclinks.AuthenticateParams{
@@ -177,7 +378,29 @@ func (a *StytchAuth) magicLinkCallback(db *database.DB) func(*fiber.Ctx) error {
 			SessionDurationMinutes: 60,
 		})
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).SendString("invalid or expired link")
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionLoginFailed,
+				Detail: err.Error(),
+			})
+			return apperr.Unauthorized("invalid or expired link")
+		}
+
+		u, err := user.GetUserByStytchID(c.UserContext(), db, res.UserID)
+		if err != nil {
+			return apperr.Internal("failed to get user by stytch ID", err)
+		}
+		if u == nil {
+			return apperr.Internal("user not found", fmt.Errorf("no user for stytch ID %s", res.UserID))
+		}
+		if u.IsDisabled() {
+			_, _ = a.Client.Sessions.Revoke(ctx, &sessions.RevokeParams{SessionToken: res.SessionToken})
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionLoginFailed,
+				UserID: u.ID,
+				FarmID: u.FarmID,
+				Detail: "account disabled",
+			})
+			return apperr.Forbidden("this account has been disabled")
 		}
 
 		// Set the session token cookie
@@ -190,19 +413,11 @@ func (a *StytchAuth) magicLinkCallback(db *database.DB) func(*fiber.Ctx) error {
 			SameSite: fiber.CookieSameSiteLaxMode,
 			Path:     "/",
 		})
-
-		u, err := user.GetUserByStytchID(c.Context(), db, res.UserID)
-		if err != nil {
-			return utils.LogAndRespondError(
-				c,
-				"failed to get user by stytch ID",
-				err,
-				fiber.StatusInternalServerError,
-			)
-		}
-		if u == nil {
-			return c.Status(fiber.StatusInternalServerError).SendString("user not found")
-		}
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionLogin,
+			UserID: u.ID,
+			FarmID: u.FarmID,
+		})
 
 		if u.Name == "" {
 			// No name yet, go to complete profile page
@@ -218,17 +433,32 @@ func (a *StytchAuth) magicLinkCallback(db *database.DB) func(*fiber.Ctx) error {
 	}
 }
 
-func (a *StytchAuth) logout(c *fiber.Ctx) error {
-	token := c.Cookies(a.CookieName)
-	if token != "" {
-		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Second)
-		defer cancel()
+func (a *StytchAuth) logout(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		token := c.Cookies(a.CookieName)
+		if token != "" {
+			ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+			defer cancel()
 
-		_, _ = a.Client.Sessions.Revoke(ctx, &sessions.RevokeParams{SessionToken: token})
-		c.Cookie(&fiber.Cookie{Name: a.CookieName, Value: "", Expires: time.Unix(0, 0), HTTPOnly: true, Secure: isSecure(c), SameSite: fiber.CookieSameSiteLaxMode, Path: "/"})
+			// Look up who is logging out before the session goes away
+			event := audit.Event{Action: audit.ActionLogout}
+			if res, err := a.Client.Sessions.Authenticate(ctx, &sessions.AuthenticateParams{SessionToken: token}); err == nil {
+				if u, err := user.GetUserByStytchID(ctx, db, res.Session.UserID); err == nil && u != nil {
+					event.UserID = u.ID
+					event.FarmID = u.FarmID
+				}
+			}
+			if _, err := a.Client.Sessions.Revoke(ctx, &sessions.RevokeParams{SessionToken: token}); err != nil {
+				logging.From(c).Warn("failed to revoke session on logout", "error", err)
+			} else {
+				event.Detail = "session revoked"
+			}
+			audit.Record(c, db, event)
+			a.ClearSession(c)
+			return c.Redirect("/")
+		}
 		return c.Redirect("/")
 	}
-	return c.Redirect("/")
 }
 
 func isSecure(c *fiber.Ctx) bool {
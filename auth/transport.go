@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// stytchIDPattern matches IDs in Stytch API paths such as
+// "user-test-16d9ba61-97a1-4ba4-9720-b03761dc50c6".
+var stytchIDPattern = regexp.MustCompile(`^[a-z-]+-(test|live)-[0-9a-f-]+$`)
+
+// instrumentedTransport records the latency and failures of every call the
+// Stytch client makes.
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	observed := err
+	if err == nil && res.StatusCode >= http.StatusBadRequest {
+		observed = fmt.Errorf("stytch responded %d", res.StatusCode)
+	}
+	metrics.ObserveStytch(stytchOperation(req), start, observed)
+	return res, err
+}
+
+// stytchOperation names a request by method and path with IDs replaced,
+// e.g. "DELETE users/:id", so it can be used as a metric label.
+func stytchOperation(req *http.Request) string {
+	segments := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1/"), "/")
+	for i, s := range segments {
+		if stytchIDPattern.MatchString(s) {
+			segments[i] = ":id"
+		}
+	}
+	return req.Method + " " + strings.Join(segments, "/")
+}
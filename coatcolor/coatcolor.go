@@ -0,0 +1,248 @@
+// Package coatcolor predicts the coat colors of foals from the color
+// genotypes of their parents.
+package coatcolor
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Locus is a gene affecting coat color. Alleles lists its alleles, the
+// first being the one horses carry without the variant.
+type Locus struct {
+	Symbol  string
+	Name    string
+	Alleles []string
+	// UnknownSplits marks loci with no usual allele to assume when a
+	// parent is untested; each of its alleles is then taken as equally
+	// likely. Other loci assume the first allele.
+	UnknownSplits bool
+}
+
+// Loci are the loci the calculator knows, in the order genotypes are
+// written.
+var Loci = []Locus{
+	{Symbol: "E", Name: "Extension", Alleles: []string{"E", "e"}, UnknownSplits: true},
+	{Symbol: "A", Name: "Agouti", Alleles: []string{"A", "a"}, UnknownSplits: true},
+	{Symbol: "Cr", Name: "Cream", Alleles: []string{"n", "Cr"}},
+	{Symbol: "D", Name: "Dun", Alleles: []string{"nd", "D"}},
+	{Symbol: "Z", Name: "Silver", Alleles: []string{"n", "Z"}},
+	{Symbol: "G", Name: "Grey", Alleles: []string{"n", "G"}},
+	{Symbol: "TO", Name: "Tobiano", Alleles: []string{"n", "TO"}},
+}
+
+// Genotypes lists the genotypes possible at the locus, such as "E/E",
+// "E/e" and "e/e".
+func (l Locus) Genotypes() []string {
+	var genotypes []string
+	for i, a := range l.Alleles {
+		for _, b := range l.Alleles[i:] {
+			genotypes = append(genotypes, a+"/"+b)
+		}
+	}
+	return genotypes
+}
+
+// pair writes two alleles in the locus's order, so that "e/E" and "E/e"
+// are the same genotype.
+func (l Locus) pair(a, b string) string {
+	if slices.Index(l.Alleles, a) > slices.Index(l.Alleles, b) {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// alleles splits a genotype of the locus into its two alleles.
+func (l Locus) alleles(genotype string) (string, string, error) {
+	a, b, ok := strings.Cut(genotype, "/")
+	if !ok || !slices.Contains(l.Alleles, a) || !slices.Contains(l.Alleles, b) {
+		return "", "", fmt.Errorf("invalid %s genotype: %q", l.Name, genotype)
+	}
+	return a, b, nil
+}
+
+// Genotype maps locus symbols to genotypes, such as "Cr" to "n/Cr". Loci
+// that have not been tested are missing.
+type Genotype map[string]string
+
+// Validate checks every entry is a genotype of a known locus.
+func (g Genotype) Validate() error {
+	for symbol, genotype := range g {
+		i := slices.IndexFunc(Loci, func(l Locus) bool { return l.Symbol == symbol })
+		if i < 0 {
+			return fmt.Errorf("unknown locus: %s", symbol)
+		}
+		if _, _, err := Loci[i].alleles(genotype); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String writes the tested loci, such as "E/e A/a n/Cr".
+func (g Genotype) String() string {
+	var parts []string
+	for _, l := range Loci {
+		if genotype, ok := g[l.Symbol]; ok {
+			parts = append(parts, genotype)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// gametes returns the chance of a parent passing on each allele.
+func gametes(l Locus, genotype string) map[string]float64 {
+	a, b, err := l.alleles(genotype)
+	if err != nil {
+		if !l.UnknownSplits {
+			return map[string]float64{l.Alleles[0]: 1}
+		}
+		split := map[string]float64{}
+		for _, allele := range l.Alleles {
+			split[allele] = 1 / float64(len(l.Alleles))
+		}
+		return split
+	}
+	g := map[string]float64{}
+	g[a] += 0.5
+	g[b] += 0.5
+	return g
+}
+
+// Outcome is a coat color a foal may have.
+type Outcome struct {
+	Color       string
+	Probability float64
+}
+
+func (o Outcome) Percent() string {
+	return fmt.Sprintf("%.1f%%", o.Probability*100)
+}
+
+type Prediction struct {
+	// Outcomes are ordered from the most likely down
+	Outcomes []Outcome
+	// Assumed names the loci a parent was untested at, where the
+	// prediction rests on an assumed genotype
+	Assumed []string
+}
+
+// Predict returns the chance of each coat color in a foal of sire and dam.
+// Loci are assumed to be inherited independently.
+func Predict(sire, dam Genotype) *Prediction {
+	p := &Prediction{}
+	// Start from a single certain foal and extend it one locus at a time
+	foals := map[string]float64{"": 1}
+	genotypes := map[string]Genotype{"": {}}
+	for _, l := range Loci {
+		_, sireTested := sire[l.Symbol]
+		_, damTested := dam[l.Symbol]
+		if !sireTested || !damTested {
+			p.Assumed = append(p.Assumed, l.Name)
+		}
+		offspring := map[string]float64{}
+		for a, pa := range gametes(l, sire[l.Symbol]) {
+			for b, pb := range gametes(l, dam[l.Symbol]) {
+				offspring[l.pair(a, b)] += pa * pb
+			}
+		}
+
+		next := map[string]float64{}
+		nextGenotypes := map[string]Genotype{}
+		for key, pf := range foals {
+			for genotype, po := range offspring {
+				k := key + " " + genotype
+				next[k] = pf * po
+				g := Genotype{l.Symbol: genotype}
+				for s, v := range genotypes[key] {
+					g[s] = v
+				}
+				nextGenotypes[k] = g
+			}
+		}
+		foals, genotypes = next, nextGenotypes
+	}
+
+	colors := map[string]float64{}
+	for key, pf := range foals {
+		colors[Phenotype(genotypes[key])] += pf
+	}
+	for color, prob := range colors {
+		p.Outcomes = append(p.Outcomes, Outcome{Color: color, Probability: prob})
+	}
+	slices.SortFunc(p.Outcomes, func(a, b Outcome) int {
+		if c := cmp.Compare(b.Probability, a.Probability); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Color, b.Color)
+	})
+	return p
+}
+
+// count returns how many copies of the variant allele the genotype has at
+// the locus.
+func count(g Genotype, symbol, allele string) int {
+	a, b, _ := strings.Cut(g[symbol], "/")
+	n := 0
+	if a == allele {
+		n++
+	}
+	if b == allele {
+		n++
+	}
+	return n
+}
+
+// Phenotype names the coat color of a horse with the given genotype, as
+// "Palomino", "Bay Dun Tobiano" or "Grey (born Buckskin)".
+func Phenotype(g Genotype) string {
+	red := count(g, "E", "e") == 2
+	black := !red && count(g, "A", "a") == 2
+	cream := count(g, "Cr", "Cr")
+	dun := count(g, "D", "D") > 0
+	// Silver only shows on black pigment
+	silver := !red && count(g, "Z", "Z") > 0
+
+	var color string
+	switch {
+	case red && cream == 0 && dun:
+		color = "Red Dun"
+	case red && cream == 0:
+		color = "Chestnut"
+	case red && cream == 1:
+		color = "Palomino"
+	case red:
+		color = "Cremello"
+	case black && cream == 0 && dun:
+		color = "Grullo"
+	case black && cream == 0:
+		color = "Black"
+	case black && cream == 1:
+		color = "Smoky Black"
+	case black:
+		color = "Smoky Cream"
+	case cream == 0 && dun:
+		color = "Bay Dun"
+	case cream == 0:
+		color = "Bay"
+	case cream == 1:
+		color = "Buckskin"
+	default:
+		color = "Perlino"
+	}
+	if dun && cream > 0 {
+		color += " Dun"
+	}
+	if silver {
+		color = "Silver " + color
+	}
+	if count(g, "TO", "TO") > 0 {
+		color += " Tobiano"
+	}
+	if count(g, "G", "G") > 0 {
+		color = "Grey (born " + color + ")"
+	}
+	return color
+}
@@ -0,0 +1,55 @@
+package coatcolor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPredict(t *testing.T) {
+	tests := []struct {
+		name      string
+		sire, dam Genotype
+		want      map[string]float64
+	}{
+		{
+			name: "E/e by E/e",
+			sire: Genotype{"E": "E/e", "A": "A/A"},
+			dam:  Genotype{"E": "E/e", "A": "A/A"},
+			want: map[string]float64{"Bay": 0.75, "Chestnut": 0.25},
+		},
+		{
+			name: "n/Cr by n/Cr",
+			sire: Genotype{"E": "E/E", "A": "A/A", "Cr": "n/Cr"},
+			dam:  Genotype{"E": "E/E", "A": "A/A", "Cr": "n/Cr"},
+			want: map[string]float64{"Bay": 0.25, "Buckskin": 0.5, "Perlino": 0.25},
+		},
+		{
+			name: "chestnut n/Cr by chestnut n/Cr",
+			sire: Genotype{"E": "e/e", "A": "A/a", "Cr": "n/Cr"},
+			dam:  Genotype{"E": "e/e", "A": "a/a", "Cr": "n/Cr"},
+			want: map[string]float64{"Chestnut": 0.25, "Palomino": 0.5, "Cremello": 0.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Predict(tt.sire, tt.dam)
+			if len(p.Outcomes) != len(tt.want) {
+				t.Fatalf("got outcomes %+v, want %v", p.Outcomes, tt.want)
+			}
+			for _, o := range p.Outcomes {
+				want, ok := tt.want[o.Color]
+				if !ok || math.Abs(o.Probability-want) > 1e-9 {
+					t.Errorf("%s: got %v, want %v", o.Color, o.Probability, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictAssumed(t *testing.T) {
+	p := Predict(Genotype{"E": "E/e"}, Genotype{"E": "e/e"})
+	// Every locus but Extension was left untested by one parent or both
+	if len(p.Assumed) != len(Loci)-1 {
+		t.Errorf("Assumed = %v, want every locus but Extension", p.Assumed)
+	}
+}
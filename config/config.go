@@ -0,0 +1,388 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs. Values are layered: defaults,
+// then the optional config file, then .env and the process environment.
+type Config struct {
+	ListenAddr string `yaml:"listen_addr" toml:"listen_addr"`
+	// ShutdownTimeout bounds both draining requests and stopping workers
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	DB              DBConfig      `yaml:"db" toml:"db"`
+	Auth            AuthConfig    `yaml:"auth" toml:"auth"`
+	Storage         StorageConfig `yaml:"storage" toml:"storage"`
+	Mail            MailConfig    `yaml:"mail" toml:"mail"`
+	Log             LogConfig     `yaml:"log" toml:"log"`
+	Metrics         MetricsConfig `yaml:"metrics" toml:"metrics"`
+	Tracing         TracingConfig `yaml:"tracing" toml:"tracing"`
+	Health          HealthConfig  `yaml:"health" toml:"health"`
+	Jobs            JobsConfig    `yaml:"jobs" toml:"jobs"`
+	Proxy           ProxyConfig   `yaml:"proxy" toml:"proxy"`
+}
+
+type DBConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn"`
+}
+
+type AuthConfig struct {
+	StytchProjectID string `yaml:"stytch_project_id" toml:"stytch_project_id"`
+	StytchSecret    string `yaml:"stytch_secret" toml:"stytch_secret"`
+}
+
+type StorageConfig struct {
+	// Backend is "local" or "s3"
+	Backend  string `yaml:"backend" toml:"backend"`
+	LocalDir string `yaml:"local_dir" toml:"local_dir"`
+	// SigningKey signs the expiring URLs the local backend hands out. When
+	// empty a random key is used, so URLs stop working on restart.
+	SigningKey string `yaml:"signing_key" toml:"signing_key"`
+	// MaxUploadBytes caps the size of a request body, and so of an upload
+	MaxUploadBytes int      `yaml:"max_upload_bytes" toml:"max_upload_bytes"`
+	S3             S3Config `yaml:"s3" toml:"s3"`
+}
+
+// S3Config works with AWS S3 and S3-compatible servers such as MinIO.
+type S3Config struct {
+	// Endpoint is a URL such as https://s3.eu-west-2.amazonaws.com or
+	// http://localhost:9000 for a local MinIO
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	// UsePathStyle addresses the bucket in the path rather than the host
+	// name, which MinIO needs
+	UsePathStyle bool `yaml:"use_path_style" toml:"use_path_style"`
+}
+
+// MailConfig is optional; outgoing mail is disabled when SMTPHost is empty.
+type MailConfig struct {
+	From         string `yaml:"from" toml:"from"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `yaml:"level" toml:"level"`
+	// Format is "json" for production or "text" for local development
+	Format string `yaml:"format" toml:"format"`
+}
+
+// MetricsConfig controls the Prometheus endpoint, which is served on its own
+// internal address so it is never exposed alongside the public site. An
+// empty Addr disables it.
+type MetricsConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+type TracingConfig struct {
+	// Exporter is "none", "stdout" for offline debugging, or "otlp"
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// OTLPEndpoint is the collector URL, e.g. http://localhost:4318. When
+	// empty the exporter falls back to the standard OTEL_EXPORTER_OTLP_*
+	// variables.
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	ServiceName  string `yaml:"service_name" toml:"service_name"`
+}
+
+type HealthConfig struct {
+	// CheckAuth makes /readyz also require Stytch to be reachable. Off by
+	// default so a Stytch outage does not take every instance out of rotation.
+	CheckAuth bool `yaml:"check_auth" toml:"check_auth"`
+}
+
+type JobsConfig struct {
+	// Concurrency is how many jobs this instance runs at once
+	Concurrency int `yaml:"concurrency" toml:"concurrency"`
+	// PollInterval is how long an idle worker waits before looking again
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+// ProxyConfig describes the reverse proxy in front of the server. The client
+// address is only read from Header on requests that arrive from one of
+// TrustedProxies, so a client can't spoof the IP recorded in audit events.
+// With Header empty the connection's remote address is used.
+type ProxyConfig struct {
+	// Header is the header the proxy sets, e.g. X-Forwarded-For
+	Header string `yaml:"header" toml:"header"`
+	// TrustedProxies lists proxy IPs or CIDR ranges
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+func (m MailConfig) Enabled() bool {
+	return m.SMTPHost != ""
+}
+
+func defaults() *Config {
+	return &Config{
+		ListenAddr:      ":4242",
+		ShutdownTimeout: 15 * time.Second,
+		Storage: StorageConfig{
+			Backend:        "local",
+			LocalDir:       "data/storage",
+			MaxUploadBytes: 32 << 20,
+		},
+		Mail: MailConfig{
+			SMTPPort: 587,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Metrics: MetricsConfig{
+			Addr: "127.0.0.1:9091",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "devonfarm-sales",
+		},
+		Jobs: JobsConfig{
+			Concurrency:  4,
+			PollInterval: 2 * time.Second,
+		},
+	}
+}
+
+// Load reads the configuration. path names an optional YAML or TOML file and
+// may be empty. Every invalid or missing value is reported in the returned
+// error, not just the first one.
+func Load(path string) (*Config, error) {
+	// A missing .env file is fine, the environment may be set directly
+	_ = godotenv.Load()
+
+	cfg := defaults()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var problems []error
+	problems = append(problems, cfg.loadEnv()...)
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(problems...))
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file type %q, use .yaml or .toml", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides values with any environment variables that are set.
+func (c *Config) loadEnv() []error {
+	strs := map[string]*string{
+		"LISTEN_ADDR":          &c.ListenAddr,
+		"COCKROACH_DSN":        &c.DB.DSN,
+		"STYTCH_PROJECT_ID":    &c.Auth.StytchProjectID,
+		"STYTCH_SECRET":        &c.Auth.StytchSecret,
+		"STORAGE_BACKEND":      &c.Storage.Backend,
+		"STORAGE_LOCAL_DIR":    &c.Storage.LocalDir,
+		"STORAGE_SIGNING_KEY":  &c.Storage.SigningKey,
+		"S3_ENDPOINT":          &c.Storage.S3.Endpoint,
+		"S3_REGION":            &c.Storage.S3.Region,
+		"S3_BUCKET":            &c.Storage.S3.Bucket,
+		"S3_ACCESS_KEY_ID":     &c.Storage.S3.AccessKeyID,
+		"S3_SECRET_ACCESS_KEY": &c.Storage.S3.SecretAccessKey,
+		"MAIL_FROM":            &c.Mail.From,
+		"SMTP_HOST":            &c.Mail.SMTPHost,
+		"SMTP_USERNAME":        &c.Mail.SMTPUsername,
+		"SMTP_PASSWORD":        &c.Mail.SMTPPassword,
+		"LOG_LEVEL":            &c.Log.Level,
+		"LOG_FORMAT":           &c.Log.Format,
+		"METRICS_ADDR":         &c.Metrics.Addr,
+		"TRACING_EXPORTER":     &c.Tracing.Exporter,
+		"TRACING_ENDPOINT":     &c.Tracing.OTLPEndpoint,
+		"OTEL_SERVICE_NAME":    &c.Tracing.ServiceName,
+		"PROXY_HEADER":         &c.Proxy.Header,
+	}
+	for name, dst := range strs {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		c.Proxy.TrustedProxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.Proxy.TrustedProxies = append(c.Proxy.TrustedProxies, p)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"SMTP_PORT":                &c.Mail.SMTPPort,
+		"JOBS_CONCURRENCY":         &c.Jobs.Concurrency,
+		"STORAGE_MAX_UPLOAD_BYTES": &c.Storage.MaxUploadBytes,
+	}
+	var problems []error
+	for name, dst := range ints {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s must be a number, got %q", name, v))
+			continue
+		}
+		*dst = n
+	}
+
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":   &c.ShutdownTimeout,
+		"JOBS_POLL_INTERVAL": &c.Jobs.PollInterval,
+	}
+	for name, dst := range durations {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s must be a duration like 15s, got %q", name, v))
+			continue
+		}
+		*dst = d
+	}
+
+	bools := map[string]*bool{
+		"READINESS_CHECK_AUTH": &c.Health.CheckAuth,
+		"S3_USE_PATH_STYLE":    &c.Storage.S3.UsePathStyle,
+	}
+	for name, dst := range bools {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s must be true or false, got %q", name, v))
+			continue
+		}
+		*dst = b
+	}
+	return problems
+}
+
+func (c *Config) validate() []error {
+	var problems []error
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		problems = append(problems, fmt.Errorf("listen address %q must be host:port: %w", c.ListenAddr, err))
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, fmt.Errorf("shutdown timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+	if c.DB.DSN == "" {
+		problems = append(problems, errors.New("missing database DSN (COCKROACH_DSN)"))
+	}
+	if c.Auth.StytchProjectID == "" {
+		problems = append(problems, errors.New("missing Stytch project ID (STYTCH_PROJECT_ID)"))
+	}
+	if c.Auth.StytchSecret == "" {
+		problems = append(problems, errors.New("missing Stytch secret (STYTCH_SECRET)"))
+	}
+	switch c.Storage.Backend {
+	case "local":
+		if c.Storage.LocalDir == "" {
+			problems = append(problems, errors.New("local storage needs a directory (STORAGE_LOCAL_DIR)"))
+		}
+	case "s3":
+		s3 := c.Storage.S3
+		if s3.Endpoint == "" {
+			problems = append(problems, errors.New("s3 storage needs an endpoint (S3_ENDPOINT)"))
+		} else if u, err := url.Parse(s3.Endpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Errorf("s3 endpoint %q must be an http or https URL", s3.Endpoint))
+		}
+		if s3.Bucket == "" {
+			problems = append(problems, errors.New("s3 storage needs a bucket (S3_BUCKET)"))
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			problems = append(problems, errors.New("s3 storage needs credentials (S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY)"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("storage backend must be \"local\" or \"s3\", got %q", c.Storage.Backend))
+	}
+	if c.Storage.MaxUploadBytes < 1<<20 {
+		problems = append(problems, fmt.Errorf("max upload size must be at least 1MiB, got %d bytes", c.Storage.MaxUploadBytes))
+	}
+	if c.Mail.Enabled() {
+		if c.Mail.From == "" {
+			problems = append(problems, errors.New("mail is enabled but has no from address (MAIL_FROM)"))
+		}
+		if c.Mail.SMTPPort < 1 || c.Mail.SMTPPort > 65535 {
+			problems = append(problems, fmt.Errorf("SMTP port %d is out of range", c.Mail.SMTPPort))
+		}
+	}
+	if c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			problems = append(problems, fmt.Errorf("metrics address %q must be host:port: %w", c.Metrics.Addr, err))
+		} else if c.Metrics.Addr == c.ListenAddr {
+			problems = append(problems, errors.New("metrics address must differ from the listen address"))
+		}
+	}
+	if c.Proxy.Header != "" && len(c.Proxy.TrustedProxies) == 0 {
+		problems = append(problems, errors.New("proxy header is set but no trusted proxies are listed (TRUSTED_PROXIES)"))
+	}
+	for _, p := range c.Proxy.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				problems = append(problems, fmt.Errorf("trusted proxy %q must be an IP address or CIDR range", p))
+			}
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Errorf("trace exporter must be \"none\", \"stdout\" or \"otlp\", got %q", c.Tracing.Exporter))
+	}
+	if c.Jobs.Concurrency < 1 {
+		problems = append(problems, fmt.Errorf("job concurrency must be at least 1, got %d", c.Jobs.Concurrency))
+	}
+	if c.Jobs.PollInterval <= 0 {
+		problems = append(problems, fmt.Errorf("job poll interval must be positive, got %s", c.Jobs.PollInterval))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		problems = append(problems, fmt.Errorf("log level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		problems = append(problems, fmt.Errorf("log format must be \"json\" or \"text\", got %q", c.Log.Format))
+	}
+	return problems
+}
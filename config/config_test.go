@@ -0,0 +1,200 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequired sets the settings Load insists on, so each test only has to
+// set what it is about.
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("COCKROACH_DSN", "postgres://localhost:26257/sales")
+	t.Setenv("STYTCH_PROJECT_ID", "project-test")
+	t.Setenv("STYTCH_SECRET", "secret")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		// file names a config file holding body, if any
+		file  string
+		body  string
+		env   map[string]string
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.ListenAddr != ":4242" || cfg.Log.Level != "info" || cfg.Jobs.Concurrency != 4 {
+					t.Errorf("got %q, %q, %d, want the defaults", cfg.ListenAddr, cfg.Log.Level, cfg.Jobs.Concurrency)
+				}
+			},
+		},
+		{
+			name: "yaml file over defaults",
+			file: "config.yaml",
+			body: "listen_addr: \":5000\"\nlog:\n  level: debug\njobs:\n  concurrency: 8\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.ListenAddr != ":5000" || cfg.Log.Level != "debug" || cfg.Jobs.Concurrency != 8 {
+					t.Errorf("got %q, %q, %d, want the file's values", cfg.ListenAddr, cfg.Log.Level, cfg.Jobs.Concurrency)
+				}
+				// Settings the file leaves out keep their defaults
+				if cfg.Log.Format != "json" || cfg.ShutdownTimeout != 15*time.Second {
+					t.Errorf("got %q, %s, want the defaults", cfg.Log.Format, cfg.ShutdownTimeout)
+				}
+			},
+		},
+		{
+			name: "toml file over defaults",
+			file: "config.toml",
+			body: "listen_addr = \":5000\"\n[storage]\nbackend = \"local\"\nlocal_dir = \"/srv/blobs\"\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.ListenAddr != ":5000" || cfg.Storage.LocalDir != "/srv/blobs" {
+					t.Errorf("got %q, %q, want the file's values", cfg.ListenAddr, cfg.Storage.LocalDir)
+				}
+			},
+		},
+		{
+			name: "environment over file",
+			file: "config.yaml",
+			body: "listen_addr: \":5000\"\nlog:\n  level: debug\n",
+			env:  map[string]string{"LOG_LEVEL": "warn", "JOBS_CONCURRENCY": "2", "SHUTDOWN_TIMEOUT": "30s"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.ListenAddr != ":5000" {
+					t.Errorf("ListenAddr = %q, want the file's :5000", cfg.ListenAddr)
+				}
+				if cfg.Log.Level != "warn" || cfg.Jobs.Concurrency != 2 || cfg.ShutdownTimeout != 30*time.Second {
+					t.Errorf("got %q, %d, %s, want the environment's values", cfg.Log.Level, cfg.Jobs.Concurrency, cfg.ShutdownTimeout)
+				}
+			},
+		},
+		{
+			name: "trusted proxies list",
+			env:  map[string]string{"PROXY_HEADER": "X-Forwarded-For", "TRUSTED_PROXIES": "10.0.0.0/8, 127.0.0.1,"},
+			check: func(t *testing.T, cfg *Config) {
+				got := strings.Join(cfg.Proxy.TrustedProxies, " ")
+				if got != "10.0.0.0/8 127.0.0.1" {
+					t.Errorf("TrustedProxies = %q, want 10.0.0.0/8 127.0.0.1", got)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, tt.file, tt.body)
+			}
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want are substrings that must all appear in the one error
+		want []string
+	}{
+		{
+			name: "missing required settings",
+			env:  map[string]string{"COCKROACH_DSN": "", "STYTCH_SECRET": ""},
+			want: []string{"missing database DSN", "missing Stytch secret"},
+		},
+		{
+			name: "unparseable values",
+			env:  map[string]string{"JOBS_CONCURRENCY": "many", "SHUTDOWN_TIMEOUT": "15", "S3_USE_PATH_STYLE": "maybe"},
+			want: []string{"JOBS_CONCURRENCY must be a number", "SHUTDOWN_TIMEOUT must be a duration", "S3_USE_PATH_STYLE must be true or false"},
+		},
+		{
+			name: "invalid values",
+			env:  map[string]string{"LISTEN_ADDR": "4242", "LOG_LEVEL": "loud", "TRACING_EXPORTER": "jaeger", "STORAGE_BACKEND": "ftp"},
+			want: []string{"listen address", "log level", "trace exporter", "storage backend"},
+		},
+		{
+			name: "s3 without bucket or credentials",
+			env:  map[string]string{"STORAGE_BACKEND": "s3", "S3_ENDPOINT": "localhost:9000"},
+			want: []string{"s3 endpoint", "needs a bucket", "needs credentials"},
+		},
+		{
+			name: "metrics on the listen address",
+			env:  map[string]string{"LISTEN_ADDR": ":4242", "METRICS_ADDR": ":4242"},
+			want: []string{"metrics address must differ"},
+		},
+		{
+			name: "mail without a from address",
+			env:  map[string]string{"SMTP_HOST": "smtp.example.com", "MAIL_FROM": "", "SMTP_PORT": "70000"},
+			want: []string{"no from address", "SMTP port 70000"},
+		},
+		{
+			name: "proxy header without trusted proxies",
+			env:  map[string]string{"PROXY_HEADER": "X-Forwarded-For", "TRUSTED_PROXIES": ""},
+			want: []string{"no trusted proxies"},
+		},
+		{
+			name: "malformed trusted proxy",
+			env:  map[string]string{"TRUSTED_PROXIES": "10.0.0.0/33"},
+			want: []string{`trusted proxy "10.0.0.0/33"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load("")
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	setRequired(t)
+	tests := []struct {
+		name, file, body, want string
+	}{
+		{"unsupported type", "config.json", "{}", "unsupported config file type"},
+		{"malformed yaml", "config.yaml", "listen_addr: [", "failed to parse config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeFile(t, tt.file, tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
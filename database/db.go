@@ -4,16 +4,39 @@ import (
 	"context"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/DevonFarm/sales/tracing"
 )
 
+// DB is a connection pool, safe for use by concurrent handlers and
+// background workers.
 type DB struct {
-	*pgx.Conn
+	*pgxpool.Pool
 }
 
 func NewDBConn(connString string) (*DB, error) {
-	conn, err := pgx.Connect(context.Background(), connString)
+	cfg, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.Tracer = tracing.QueryTracer{}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{Conn: conn}, nil
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &DB{Pool: pool}, nil
+}
+
+// Querier is satisfied by both *DB and pgx.Tx, for queries that must also
+// run inside a caller's transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
@@ -0,0 +1,30 @@
+// Package dbtest connects tests to a scratch database. Tests that need one
+// are skipped unless TEST_DATABASE_DSN is set, and expect every migration
+// to have been applied with `task db-migrate`. They freely delete rows, so
+// never point it at a database whose data matters.
+package dbtest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DevonFarm/sales/database"
+)
+
+const dsnEnv = "TEST_DATABASE_DSN"
+
+// Open connects to the test database, or skips t when there is none. The
+// connection is closed when t finishes.
+func Open(t testing.TB) *database.DB {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skip(dsnEnv + " is not set")
+	}
+	db, err := database.NewDBConn(dsn)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// migrations holds the files applied by `task db-migrate` so the server
+// knows which schema version it was built against.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// LatestMigration returns the version of the newest migration file.
+func LatestMigration() (uint64, error) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	var latest uint64
+	for _, e := range entries {
+		prefix, _, ok := strings.Cut(e.Name(), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %s: %w", e.Name(), err)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// MigrationVersion returns the schema version recorded by golang-migrate
+// and whether the last migration failed part way.
+func (db *DB) MigrationVersion(ctx context.Context) (uint64, bool, error) {
+	var version int64
+	var dirty bool
+	row := db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err := row.Scan(&version, &dirty); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
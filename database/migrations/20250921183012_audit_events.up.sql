@@ -0,0 +1,15 @@
+-- audit_events is append-only: rows are never updated or deleted by the
+-- application, so user_id and farm_id deliberately carry no foreign keys
+-- and survive the deletion of the user or farm they refer to.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    action STRING NOT NULL,
+    user_id UUID,
+    farm_id UUID,
+    detail STRING NOT NULL DEFAULT '',
+    ip STRING NOT NULL DEFAULT '',
+    user_agent STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX audit_events_farm_id_created_at_idx (farm_id, created_at DESC),
+    INDEX audit_events_user_id_created_at_idx (user_id, created_at DESC)
+);
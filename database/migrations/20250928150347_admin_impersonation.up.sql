@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOL NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS impersonations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason STRING NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
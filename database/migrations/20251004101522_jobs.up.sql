@@ -0,0 +1,19 @@
+-- jobs is the background job queue. Workers claim pending rows with
+-- SELECT ... FOR UPDATE SKIP LOCKED; a job whose attempts run out is left
+-- in the "dead" status for an admin to inspect and retry.
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind STRING NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    -- Enqueuing a second job with the same key is a no-op
+    idempotency_key STRING UNIQUE,
+    status STRING NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMP NOT NULL DEFAULT now(),
+    locked_at TIMESTAMP,
+    last_error STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX jobs_status_run_at_idx (status, run_at)
+);
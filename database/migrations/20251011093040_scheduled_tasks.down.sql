@@ -0,0 +1,3 @@
+ALTER TABLE horses DROP COLUMN IF EXISTS created_at;
+DROP TABLE IF EXISTS task_runs;
+DROP TABLE IF EXISTS scheduled_tasks;
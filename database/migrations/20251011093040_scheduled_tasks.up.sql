@@ -0,0 +1,30 @@
+-- scheduled_tasks holds one row per registered recurring task. An instance
+-- takes a lease on a due task by setting locked_by and locked_until, so
+-- only one instance runs it even when several are deployed.
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+    name STRING PRIMARY KEY,
+    schedule STRING NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    locked_by STRING,
+    locked_until TIMESTAMP,
+    last_run_at TIMESTAMP,
+    last_success_at TIMESTAMP,
+    last_error STRING NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS task_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task STRING NOT NULL,
+    instance STRING NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    error STRING NOT NULL DEFAULT '',
+    INDEX task_runs_task_started_at_idx (task, started_at DESC)
+);
+
+-- Lets the weekly digest report which horses are new. Existing horses are
+-- left NULL, since adding the column with a default would date them all to
+-- now and the first digest would list every horse as new.
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS created_at TIMESTAMP;
+ALTER TABLE horses ALTER COLUMN created_at SET DEFAULT now();
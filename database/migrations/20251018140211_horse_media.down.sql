@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS horse_documents;
+DROP TABLE IF EXISTS horse_images;
@@ -0,0 +1,22 @@
+-- Files themselves live in blob storage; these rows record where.
+CREATE TABLE IF NOT EXISTS horse_images (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    storage_key STRING NOT NULL,
+    content_type STRING NOT NULL,
+    alt STRING NOT NULL DEFAULT '',
+    position INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX horse_images_horse_id_position_idx (horse_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS horse_documents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    storage_key STRING NOT NULL,
+    filename STRING NOT NULL,
+    content_type STRING NOT NULL,
+    size INT8 NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX horse_documents_horse_id_created_at_idx (horse_id, created_at)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE horse_images DROP COLUMN IF EXISTS processed_at;
+ALTER TABLE horse_images DROP COLUMN IF EXISTS variant_widths;
+ALTER TABLE horse_images DROP COLUMN IF EXISTS height;
+ALTER TABLE horse_images DROP COLUMN IF EXISTS width;
@@ -0,0 +1,13 @@
+-- Uploads are processed in the background into a clean original plus
+-- resized variants; processed_at stays NULL until that has happened and
+-- storage_key points at the raw upload until then.
+ALTER TABLE horse_images ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE horse_images ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE horse_images ADD COLUMN IF NOT EXISTS variant_widths INT[] NOT NULL DEFAULT ARRAY[]::INT[];
+ALTER TABLE horse_images ADD COLUMN IF NOT EXISTS processed_at TIMESTAMP;
+
+-- Process the images uploaded before variants existed
+INSERT INTO jobs (kind, payload, idempotency_key)
+SELECT 'horse.process_image', json_build_object('image_id', id), 'process-image:' || id::STRING
+FROM horse_images
+ON CONFLICT (idempotency_key) DO NOTHING;
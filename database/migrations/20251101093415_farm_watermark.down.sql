@@ -0,0 +1,4 @@
+ALTER TABLE farms DROP COLUMN IF EXISTS watermark_opacity;
+ALTER TABLE farms DROP COLUMN IF EXISTS watermark_position;
+ALTER TABLE farms DROP COLUMN IF EXISTS watermark_logo_key;
+ALTER TABLE farms DROP COLUMN IF EXISTS watermark_enabled;
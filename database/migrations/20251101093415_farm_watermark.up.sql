@@ -0,0 +1,6 @@
+-- A farm may stamp its logo on the resized copies of its horse photos;
+-- the full size originals are always kept clean.
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS watermark_enabled BOOL NOT NULL DEFAULT false;
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS watermark_logo_key STRING NOT NULL DEFAULT '';
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS watermark_position STRING NOT NULL DEFAULT 'bottom_right';
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS watermark_opacity FLOAT8 NOT NULL DEFAULT 0.5;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS external_ancestors;
+DROP INDEX IF EXISTS horses@horses_dam_id_idx;
+DROP INDEX IF EXISTS horses@horses_sire_id_idx;
+ALTER TABLE horses DROP COLUMN IF EXISTS dam_id;
+ALTER TABLE horses DROP COLUMN IF EXISTS sire_id;
@@ -0,0 +1,23 @@
+-- Parents may be horses of the same farm or external ancestors, ones the
+-- farm never owned that are recorded only for pedigrees. Since sire_id and
+-- dam_id can point into either table they carry no foreign key; the app
+-- checks them, and a parent that has gone is shown as unknown.
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS sire_id UUID;
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS dam_id UUID;
+CREATE INDEX IF NOT EXISTS horses_sire_id_idx ON horses (sire_id);
+CREATE INDEX IF NOT EXISTS horses_dam_id_idx ON horses (dam_id);
+
+CREATE TABLE IF NOT EXISTS external_ancestors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    farm_id UUID NOT NULL REFERENCES farms(id) ON DELETE CASCADE,
+    name STRING NOT NULL,
+    registration_number STRING NOT NULL DEFAULT '',
+    gender INT NOT NULL,
+    birth_year INT NOT NULL DEFAULT 0,
+    sire_id UUID,
+    dam_id UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX external_ancestors_farm_id_name_idx (farm_id, name),
+    INDEX external_ancestors_sire_id_idx (sire_id),
+    INDEX external_ancestors_dam_id_idx (dam_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS horse_common_ancestors;
+ALTER TABLE horses DROP COLUMN IF EXISTS coi_computed_at;
+ALTER TABLE horses DROP COLUMN IF EXISTS coi_generations;
+ALTER TABLE horses DROP COLUMN IF EXISTS coi;
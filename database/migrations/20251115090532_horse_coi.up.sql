@@ -0,0 +1,22 @@
+-- Cached coefficients of inbreeding, kept up to date by the
+-- horse.compute_coi job whenever a parent link changes. coi is NULL until
+-- first computed.
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS coi FLOAT8;
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS coi_generations INT NOT NULL DEFAULT 0;
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS coi_computed_at TIMESTAMP;
+
+-- ancestor_id may be a horse or an external ancestor, so has no foreign key
+CREATE TABLE IF NOT EXISTS horse_common_ancestors (
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    ancestor_id UUID NOT NULL,
+    contribution FLOAT8 NOT NULL,
+    paths INT NOT NULL,
+    PRIMARY KEY (horse_id, ancestor_id)
+);
+
+-- Compute the horses whose parents were entered before the cache existed
+INSERT INTO jobs (kind, payload, idempotency_key)
+SELECT 'horse.compute_coi', json_build_object('root_id', id), 'compute-coi:' || id::STRING || ':initial'
+FROM horses
+WHERE sire_id IS NOT NULL OR dam_id IS NOT NULL
+ON CONFLICT (idempotency_key) DO NOTHING;
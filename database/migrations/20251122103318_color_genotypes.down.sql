@@ -0,0 +1,2 @@
+ALTER TABLE external_ancestors DROP COLUMN IF EXISTS color_genotype;
+ALTER TABLE horses DROP COLUMN IF EXISTS color_genotype;
@@ -0,0 +1,4 @@
+-- Coat color genotypes by locus symbol, e.g. {"E": "E/e", "Cr": "n/Cr"}.
+-- Loci that have not been tested are left out.
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS color_genotype JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE external_ancestors ADD COLUMN IF NOT EXISTS color_genotype JSONB NOT NULL DEFAULT '{}';
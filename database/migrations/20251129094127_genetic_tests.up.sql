@@ -0,0 +1,14 @@
+-- A certificate is one of the horse's documents; deleting it keeps the
+-- result.
+CREATE TABLE IF NOT EXISTS horse_genetic_tests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    condition STRING NOT NULL,
+    result STRING NOT NULL,
+    lab STRING NOT NULL DEFAULT '',
+    tested_on DATE NOT NULL,
+    document_id UUID REFERENCES horse_documents(id) ON DELETE SET NULL,
+    public BOOL NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX horse_genetic_tests_horse_id_condition_idx (horse_id, condition, tested_on DESC)
+);
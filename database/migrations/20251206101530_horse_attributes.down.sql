@@ -0,0 +1,5 @@
+ALTER TABLE horses DROP COLUMN IF EXISTS height_hands;
+ALTER TABLE horses DROP COLUMN IF EXISTS markings;
+ALTER TABLE horses DROP COLUMN IF EXISTS color;
+DROP TABLE IF EXISTS horse_breeds;
+DROP TABLE IF EXISTS breeds;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS breeds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name STRING NOT NULL UNIQUE
+);
+
+INSERT INTO breeds (name) VALUES
+    ('Friesian'),
+    ('Gypsian'),
+    ('Gypsy Vanner'),
+    ('Norwegian Fjord'),
+    ('Haflinger'),
+    ('Percheron'),
+    ('Clydesdale'),
+    ('Shire'),
+    ('Andalusian'),
+    ('Arabian'),
+    ('Thoroughbred'),
+    ('Quarter Horse'),
+    ('Welsh Cob')
+ON CONFLICT (name) DO NOTHING;
+
+-- A horse's shares of its breeds; a purebred has a single 100% share.
+CREATE TABLE IF NOT EXISTS horse_breeds (
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    breed_id UUID NOT NULL REFERENCES breeds(id),
+    percent INT NOT NULL CHECK (percent > 0 AND percent <= 100),
+    PRIMARY KEY (horse_id, breed_id),
+    INDEX horse_breeds_breed_id_idx (breed_id)
+);
+
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS color STRING NOT NULL DEFAULT '';
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS markings STRING NOT NULL DEFAULT '';
+-- Height in hands as a plain number, so 15.2 hh is 15.5; 0 when unmeasured.
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS height_hands FLOAT8 NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE farms DROP COLUMN IF EXISTS mature_age;
+ALTER TABLE farms DROP COLUMN IF EXISTS weaning_months;
+ALTER TABLE farms DROP COLUMN IF EXISTS registry_aging;
@@ -0,0 +1,3 @@
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS registry_aging BOOL NOT NULL DEFAULT false;
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS weaning_months INT NOT NULL DEFAULT 6;
+ALTER TABLE farms ADD COLUMN IF NOT EXISTS mature_age INT NOT NULL DEFAULT 4;
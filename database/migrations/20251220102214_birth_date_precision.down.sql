@@ -0,0 +1,3 @@
+UPDATE horses SET date_of_birth = '0001-01-01' WHERE date_of_birth IS NULL;
+ALTER TABLE horses ALTER COLUMN date_of_birth SET NOT NULL;
+ALTER TABLE horses DROP COLUMN IF EXISTS birth_date_precision;
@@ -0,0 +1,6 @@
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS birth_date_precision STRING NOT NULL DEFAULT 'exact';
+ALTER TABLE horses ALTER COLUMN date_of_birth DROP NOT NULL;
+
+-- Horses created without a birth date were stored with the zero time
+UPDATE horses SET date_of_birth = NULL, birth_date_precision = 'unknown'
+WHERE date_of_birth = '0001-01-01';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS horse_gender_events;
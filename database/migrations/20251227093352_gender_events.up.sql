@@ -0,0 +1,12 @@
+-- Changes of a horse's sex classification, such as gelding, keep the
+-- horse's earlier classification for its breeding record.
+CREATE TABLE IF NOT EXISTS horse_gender_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    from_gender INTEGER NOT NULL,
+    to_gender INTEGER NOT NULL,
+    changed_on DATE NOT NULL,
+    note STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX horse_gender_events_horse_id_changed_on_idx (horse_id, changed_on)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS horse_status_events;
+DROP INDEX IF EXISTS horses@horses_farm_id_status_idx;
+ALTER TABLE horses DROP COLUMN IF EXISTS status;
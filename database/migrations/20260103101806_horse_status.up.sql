@@ -0,0 +1,13 @@
+ALTER TABLE horses ADD COLUMN IF NOT EXISTS status STRING NOT NULL DEFAULT 'active';
+CREATE INDEX IF NOT EXISTS horses_farm_id_status_idx ON horses (farm_id, status);
+
+CREATE TABLE IF NOT EXISTS horse_status_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    horse_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    from_status STRING NOT NULL,
+    to_status STRING NOT NULL,
+    changed_on DATE NOT NULL,
+    reason STRING NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX horse_status_events_horse_id_changed_on_idx (horse_id, changed_on)
+);
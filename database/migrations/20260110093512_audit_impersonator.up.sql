@@ -0,0 +1,3 @@
+-- impersonator_id is the admin who acted while impersonating user_id. Like
+-- user_id it carries no foreign key so it outlives the admin's account.
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS impersonator_id UUID;
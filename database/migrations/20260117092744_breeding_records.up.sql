@@ -0,0 +1,12 @@
+-- A cover of one of the farm's mares. The sire may be a horse or an
+-- external ancestor, so like a horse's sire_id it carries no foreign key.
+CREATE TABLE IF NOT EXISTS breeding_records (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    farm_id UUID NOT NULL REFERENCES farms(id) ON DELETE CASCADE,
+    mare_id UUID NOT NULL REFERENCES horses(id) ON DELETE CASCADE,
+    sire_id UUID NOT NULL,
+    covered_on DATE NOT NULL,
+    note STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    INDEX breeding_records_farm_id_covered_on_idx (farm_id, covered_on DESC)
+);
@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
 	"github.com/DevonFarm/sales/user"
 )
 
@@ -26,6 +27,8 @@ func NewFarm(ctx context.Context, name string, db *database.DB, userID string) (
 }
 
 func (f *Farm) Save(ctx context.Context, db *database.DB, userID string) error {
+	defer metrics.TimeQuery("farm.Save")()
+
 	if f.ID == uuid.Nil {
 		u, err := user.GetUser(ctx, db, userID)
 		if err != nil {
@@ -45,6 +48,7 @@ func (f *Farm) Save(ctx context.Context, db *database.DB, userID string) error {
 			if err := row.Scan(&f.ID); err != nil {
 				return fmt.Errorf("failed to insert farm: %w", err)
 			}
+			metrics.FarmsCreated.Inc()
 			// Associate the farm with the user
 			_, err := db.Exec(
 				ctx,
@@ -72,6 +76,8 @@ func (f *Farm) Save(ctx context.Context, db *database.DB, userID string) error {
 }
 
 func GetFarm(ctx context.Context, db *database.DB, farmID string) (*Farm, error) {
+	defer metrics.TimeQuery("farm.GetFarm")()
+
 	var farm Farm
 	row := db.QueryRow(
 		ctx,
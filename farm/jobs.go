@@ -0,0 +1,73 @@
+package farm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/mail"
+	"github.com/DevonFarm/sales/user"
+)
+
+const TransferNoticeJob = "farm.transfer_notice"
+
+type transferNotice struct {
+	FarmID   uuid.UUID `json:"farm_id"`
+	ToUserID uuid.UUID `json:"to_user_id"`
+	FromName string    `json:"from_name"`
+}
+
+// RegisterJobs registers the handlers for the farm package's jobs.
+func RegisterJobs(q *jobs.Queue, db *database.DB, mailer *mail.Mailer) {
+	q.Handle(TransferNoticeJob, sendTransferNotice(db, mailer))
+	q.Handle(WeeklyDigestJob, sendWeeklyDigest(db))
+	q.Handle(WeeklyDigestMailJob, sendDigestMail(mailer))
+}
+
+// EnqueueTransferNotice queues an email telling to that from has handed the
+// farm over to them.
+func EnqueueTransferNotice(ctx context.Context, db jobs.Execer, farmID uuid.UUID, from, to *user.User) error {
+	return jobs.Enqueue(
+		ctx,
+		db,
+		TransferNoticeJob,
+		fmt.Sprintf("farm-transfer:%s:%s", farmID, from.ID),
+		transferNotice{FarmID: farmID, ToUserID: to.ID, FromName: from.Name},
+	)
+}
+
+func sendTransferNotice(db *database.DB, mailer *mail.Mailer) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p transferNotice
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		f, err := GetFarm(ctx, db, p.FarmID.String())
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Deleted since; nothing to tell
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		to, err := user.GetUser(ctx, db, p.ToUserID.String())
+		if err != nil {
+			return err
+		}
+		if to == nil || to.FarmID != f.ID {
+			// The farm has changed hands again
+			return nil
+		}
+		body := fmt.Sprintf(
+			"Hi %s,\n\n%s has closed their account and handed %s over to you. "+
+				"You are now responsible for its horses and listings.\n",
+			to.Name, p.FromName, f.Name,
+		)
+		return mailer.Send(ctx, to.Email, fmt.Sprintf("%s is now yours", f.Name), body)
+	}
+}
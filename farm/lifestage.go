@@ -0,0 +1,47 @@
+package farm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/lifestage"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+func GetLifeStageRules(ctx context.Context, db *database.DB, farmID uuid.UUID) (lifestage.Rules, error) {
+	defer metrics.TimeQuery("farm.GetLifeStageRules")()
+
+	var r lifestage.Rules
+	row := db.QueryRow(
+		ctx,
+		`SELECT registry_aging, weaning_months, mature_age FROM farms WHERE id = $1`,
+		farmID,
+	)
+	if err := row.Scan(&r.RegistryAging, &r.WeaningMonths, &r.MatureAge); err != nil {
+		return r, fmt.Errorf("failed to get life stage rules: %w", err)
+	}
+	return r, nil
+}
+
+func SaveLifeStageRules(ctx context.Context, db *database.DB, farmID uuid.UUID, r lifestage.Rules) error {
+	defer metrics.TimeQuery("farm.SaveLifeStageRules")()
+
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		ctx,
+		`UPDATE farms SET registry_aging = $2, weaning_months = $3, mature_age = $4 WHERE id = $1`,
+		farmID,          // $1
+		r.RegistryAging, // $2
+		r.WeaningMonths, // $3
+		r.MatureAge,     // $4
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update life stage rules: %w", err)
+	}
+	return nil
+}
@@ -5,17 +5,22 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/DevonFarm/sales/apperr"
 	"github.com/DevonFarm/sales/auth"
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/user"
 )
 
 func RegisterRoutes(app *fiber.App, db *database.DB, auth *auth.StytchAuth) {
-	newFarm := app.Group("/new/farm", auth.RequireAuth())
+	newFarm := app.Group("/new/farm", auth.RequireAuth(), auth.RequireUser(db))
 	newFarm.Get("/:userID", newFarmForm)
 	newFarm.Post("/:userID", createFarm(db))
 }
 
 func newFarmForm(c *fiber.Ctx) error {
+	if !isSessionUser(c, c.Params("userID")) {
+		return apperr.NotFound("user not found")
+	}
 	return c.Render("templates/new_farm", fiber.Map{
 		"Title":  "Create New Farm",
 		"UserID": c.Params("userID"),
@@ -24,14 +29,23 @@ func newFarmForm(c *fiber.Ctx) error {
 
 func createFarm(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
+		userID := c.Params("userID")
+		if !isSessionUser(c, userID) {
+			return apperr.NotFound("user not found")
+		}
 		var f Farm
 		if err := c.BodyParser(&f); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return apperr.Validation(err.Error())
 		}
-		userID := c.Params("userID")
-		if err := f.Save(c.Context(), db, userID); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if err := f.Save(c.UserContext(), db, userID); err != nil {
+			return apperr.Internal("failed to save farm", err)
 		}
 		return c.Status(fiber.StatusCreated).Redirect(fmt.Sprintf("/farm/%s", f.ID))
 	}
 }
+
+// isSessionUser reports whether userID is the user the request acts as.
+func isSessionUser(c *fiber.Ctx, userID string) bool {
+	u, ok := c.Locals("user").(*user.User)
+	return ok && u != nil && u.ID.String() == userID
+}
@@ -0,0 +1,155 @@
+package farm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/mail"
+	"github.com/DevonFarm/sales/metrics"
+	"github.com/DevonFarm/sales/schedule"
+	"github.com/DevonFarm/sales/user"
+)
+
+const WeeklyDigestJob = "farm.weekly_digest"
+
+type weeklyDigest struct {
+	FarmID uuid.UUID `json:"farm_id"`
+	Since  time.Time `json:"since"`
+}
+
+// RegisterTasks registers the farm package's recurring tasks.
+func RegisterTasks(s *schedule.Scheduler, db *database.DB) {
+	s.Register("farm.weekly_digest", "0 7 * * MON", enqueueWeeklyDigests(db))
+}
+
+// enqueueWeeklyDigests queues one digest job per farm, so a failure to mail
+// one farm is retried on its own without holding up the others.
+func enqueueWeeklyDigests(db *database.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ids, err := getFarmIDs(ctx, db)
+		if err != nil {
+			return err
+		}
+		since := time.Now().UTC().AddDate(0, 0, -7)
+		year, week := since.ISOWeek()
+		var errs []error
+		for _, id := range ids {
+			key := fmt.Sprintf("weekly-digest:%s:%d-W%02d", id, year, week)
+			if err := jobs.Enqueue(ctx, db, WeeklyDigestJob, key, weeklyDigest{FarmID: id, Since: since}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// sendWeeklyDigest works out a farm's digest and queues a copy for each of
+// its members.
+func sendWeeklyDigest(db *database.DB) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p weeklyDigest
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		f, err := GetFarm(ctx, db, p.FarmID.String())
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		added, err := getHorsesAddedSince(ctx, db, f.ID, p.Since)
+		if err != nil {
+			return err
+		}
+		if len(added) == 0 {
+			// Nothing happened; don't send an empty digest
+			return nil
+		}
+		members, err := user.GetUsersByFarmID(ctx, db, f.ID)
+		if err != nil {
+			return err
+		}
+
+		subject := fmt.Sprintf("Your week at %s", f.Name)
+		body := fmt.Sprintf(
+			"Horses added to %s since %s:\n\n  %s\n",
+			f.Name, p.Since.Format("2 January"), strings.Join(added, "\n  "),
+		)
+		// One job per member, so a failed send is retried without mailing
+		// everyone who already has the digest again
+		year, week := p.Since.ISOWeek()
+		var errs []error
+		for _, m := range members {
+			key := fmt.Sprintf("weekly-digest-mail:%s:%s:%d-W%02d", f.ID, m.ID, year, week)
+			digest := digestMail{To: m.Email, Subject: subject, Body: body}
+			if err := jobs.Enqueue(ctx, db, WeeklyDigestMailJob, key, digest); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+const WeeklyDigestMailJob = "farm.weekly_digest_mail"
+
+// digestMail is one member's copy of a farm's weekly digest.
+type digestMail struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func sendDigestMail(mailer *mail.Mailer) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p digestMail
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		return mailer.Send(ctx, p.To, p.Subject, p.Body)
+	}
+}
+
+func getFarmIDs(ctx context.Context, db *database.DB) ([]uuid.UUID, error) {
+	defer metrics.TimeQuery("farm.getFarmIDs")()
+
+	rows, err := db.Query(ctx, `SELECT id FROM farms`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query farms: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect farm ids: %w", err)
+	}
+	return ids, nil
+}
+
+func getHorsesAddedSince(ctx context.Context, db *database.DB, farmID uuid.UUID, since time.Time) ([]string, error) {
+	defer metrics.TimeQuery("farm.getHorsesAddedSince")()
+
+	// Horses from before created_at was added have it NULL and never match
+	rows, err := db.Query(
+		ctx,
+		`SELECT name FROM horses
+		WHERE farm_id = $1 AND created_at IS NOT NULL AND created_at >= $2
+		ORDER BY name`,
+		farmID,
+		since,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query new horses: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect new horses: %w", err)
+	}
+	return names, nil
+}
@@ -0,0 +1,106 @@
+package farm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+	"github.com/DevonFarm/sales/photo"
+	"github.com/DevonFarm/sales/storage"
+)
+
+// Watermark is a farm's choice of logo stamp for its horse photos.
+type Watermark struct {
+	Enabled bool `db:"watermark_enabled"`
+	// LogoKey is the storage key of the logo as a PNG, empty until one has
+	// been uploaded
+	LogoKey  string         `db:"watermark_logo_key"`
+	Position photo.Position `db:"watermark_position"`
+	// Opacity runs from 0, invisible, to 1
+	Opacity float64 `db:"watermark_opacity"`
+}
+
+// Active reports whether photos should be watermarked.
+func (w *Watermark) Active() bool {
+	return w.Enabled && w.LogoKey != ""
+}
+
+func (w *Watermark) OpacityPercent() int {
+	return int(math.Round(w.Opacity * 100))
+}
+
+// ErrInvalidLogo is returned for a logo upload that is not a readable image.
+var ErrInvalidLogo = errors.New("logo is not a readable image")
+
+// StoreLogo saves an uploaded logo as a PNG, which keeps any transparency
+// and drops the file's metadata, and returns its storage key. A new key is
+// used per upload so that photos processed meanwhile never mix two logos.
+func StoreLogo(ctx context.Context, store storage.Store, farmID uuid.UUID, fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open logo: %w", err)
+	}
+	defer f.Close()
+	logo, err := photo.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidLogo, err)
+	}
+	b, err := photo.EncodePNG(logo)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("farms/%s/watermark/%s.png", farmID, uuid.New())
+	if err := store.Put(ctx, key, bytes.NewReader(b), int64(len(b)), "image/png"); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func GetWatermark(ctx context.Context, db *database.DB, farmID uuid.UUID) (*Watermark, error) {
+	defer metrics.TimeQuery("farm.GetWatermark")()
+
+	var w Watermark
+	row := db.QueryRow(
+		ctx,
+		`SELECT watermark_enabled, watermark_logo_key, watermark_position, watermark_opacity
+		FROM farms WHERE id = $1`,
+		farmID,
+	)
+	if err := row.Scan(&w.Enabled, &w.LogoKey, &w.Position, &w.Opacity); err != nil {
+		return nil, fmt.Errorf("failed to get watermark: %w", err)
+	}
+	return &w, nil
+}
+
+func SaveWatermark(ctx context.Context, db database.Querier, farmID uuid.UUID, w *Watermark) error {
+	defer metrics.TimeQuery("farm.SaveWatermark")()
+
+	if !w.Position.IsValid() {
+		return fmt.Errorf("invalid watermark position: %s", w.Position)
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("invalid watermark opacity: %v", w.Opacity)
+	}
+	_, err := db.Exec(
+		ctx,
+		`UPDATE farms
+		SET watermark_enabled = $2, watermark_logo_key = $3, watermark_position = $4, watermark_opacity = $5
+		WHERE id = $1`,
+		farmID,     // $1
+		w.Enabled,  // $2
+		w.LogoKey,  // $3
+		w.Position, // $4
+		w.Opacity,  // $5
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update watermark: %w", err)
+	}
+	return nil
+}
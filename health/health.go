@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// checkTimeout bounds each readiness check so a hung dependency cannot hang
+// the probe itself.
+const checkTimeout = 3 * time.Second
+
+// Check is a single readiness dependency check.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// checkResult is what /readyz reports for a check. Failures only say
+// "unavailable"; the error itself is logged, since it may name hosts or
+// carry connection strings.
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// RegisterRoutes mounts GET /healthz, which only reports that the process is
+// serving, and GET /readyz, which runs every check and answers 503 if any
+// of them fail.
+func RegisterRoutes(app *fiber.App, checks ...Check) {
+	app.Get("/healthz", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		results := runChecks(c.UserContext(), checks)
+		status := "ok"
+		code := fiber.StatusOK
+		for _, r := range results {
+			if r.Status != "ok" {
+				status = "unavailable"
+				code = fiber.StatusServiceUnavailable
+			}
+		}
+		return c.Status(code).JSON(fiber.Map{
+			"status": status,
+			"checks": results,
+		})
+	})
+}
+
+func runChecks(ctx context.Context, checks []Check) map[string]checkResult {
+	results := make(map[string]checkResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check.Run(ctx)
+			r := checkResult{Status: "ok", DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				r.Status = "unavailable"
+				slog.WarnContext(ctx, "readiness check failed", "check", check.Name, "error", err)
+			}
+			mu.Lock()
+			results[check.Name] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
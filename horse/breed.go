@@ -0,0 +1,151 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+type Breed struct {
+	ID   uuid.UUID `db:"id"`
+	Name string    `db:"name"`
+}
+
+// BreedShare is the part of a horse's breeding that is of one breed.
+type BreedShare struct {
+	Breed
+	Percent int `db:"percent"`
+}
+
+// ErrInvalidBreeds is returned for breed shares that repeat a breed, are
+// not between 1% and 100%, or add up to more than 100%.
+var ErrInvalidBreeds = errors.New("breed shares must be different breeds adding up to at most 100%")
+
+// GetBreeds returns the breeds horses may be recorded as, by name.
+func GetBreeds(ctx context.Context, db *database.DB) ([]*Breed, error) {
+	defer metrics.TimeQuery("horse.GetBreeds")()
+
+	rows, err := db.Query(ctx, `SELECT id, name FROM breeds ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query breeds: %w", err)
+	}
+	breeds, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Breed])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect breeds: %w", err)
+	}
+	return breeds, nil
+}
+
+// loadBreeds sets the breed shares of each of horses, from the largest
+// share down.
+func loadBreeds(ctx context.Context, db *database.DB, horses []*Horse) error {
+	defer metrics.TimeQuery("horse.loadBreeds")()
+
+	ids := make([]uuid.UUID, len(horses))
+	byID := make(map[uuid.UUID]*Horse, len(horses))
+	for i, h := range horses {
+		ids[i] = h.ID
+		byID[h.ID] = h
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT hb.horse_id, b.id, b.name, hb.percent
+		FROM horse_breeds hb JOIN breeds b ON b.id = hb.breed_id
+		WHERE hb.horse_id = ANY($1)
+		ORDER BY hb.percent DESC, b.name`,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query horse breeds: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var horseID uuid.UUID
+		var s BreedShare
+		if err := rows.Scan(&horseID, &s.ID, &s.Name, &s.Percent); err != nil {
+			return fmt.Errorf("failed to scan horse breed: %w", err)
+		}
+		if h, ok := byID[horseID]; ok {
+			h.Breeds = append(h.Breeds, &s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+	return nil
+}
+
+func validateBreeds(shares []*BreedShare) error {
+	seen := map[uuid.UUID]bool{}
+	total := 0
+	for _, s := range shares {
+		if s.Percent < 1 || s.Percent > 100 || seen[s.ID] {
+			return ErrInvalidBreeds
+		}
+		seen[s.ID] = true
+		total += s.Percent
+	}
+	if total > 100 {
+		return ErrInvalidBreeds
+	}
+	return nil
+}
+
+// setBreeds replaces the horse's breed shares.
+func setBreeds(ctx context.Context, tx pgx.Tx, horseID uuid.UUID, shares []*BreedShare) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM horse_breeds WHERE horse_id = $1`, horseID); err != nil {
+		return fmt.Errorf("failed to clear horse breeds: %w", err)
+	}
+	if len(shares) == 0 {
+		return nil
+	}
+	breedIDs := make([]uuid.UUID, len(shares))
+	percents := make([]int32, len(shares))
+	for i, s := range shares {
+		breedIDs[i] = s.ID
+		percents[i] = int32(s.Percent)
+	}
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO horse_breeds (horse_id, breed_id, percent)
+		SELECT $1, unnest($2::UUID[]), unnest($3::INT[])`,
+		horseID,  // $1
+		breedIDs, // $2
+		percents, // $3
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert horse breeds: %w", err)
+	}
+	return nil
+}
+
+// BreedString describes the horse's breeding, such as "Friesian" for a
+// purebred or "75% Friesian, 25% Gypsian" for a cross.
+func (h *Horse) BreedString() string {
+	if len(h.Breeds) == 1 && h.Breeds[0].Percent == 100 {
+		return h.Breeds[0].Name
+	}
+	parts := make([]string, len(h.Breeds))
+	for i, s := range h.Breeds {
+		parts[i] = fmt.Sprintf("%d%% %s", s.Percent, s.Name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BreedPercent returns the horse's share of the breed, 0 when it has none.
+func (h *Horse) BreedPercent(breedID uuid.UUID) int {
+	for _, s := range h.Breeds {
+		if s.ID == breedID {
+			return s.Percent
+		}
+	}
+	return 0
+}
@@ -0,0 +1,194 @@
+package horse
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/coatcolor"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/inbreeding"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// Coefficients above which a pairing is flagged. 6.25% is the coefficient
+// of a foal of first cousins, 12.5% of half siblings.
+const (
+	elevatedCOI = 0.0625
+	highCOI     = 0.125
+)
+
+type RiskLevel string
+
+const (
+	RiskWarning RiskLevel = "warning"
+	RiskDanger  RiskLevel = "danger"
+)
+
+// Risk is something a breeder should weigh before booking a cover.
+type Risk struct {
+	Level   RiskLevel
+	Message string
+}
+
+// Pairing is the predicted outcome of breeding a mare to a stallion.
+type Pairing struct {
+	Sire *Ancestor
+	Dam  *Ancestor
+	// COI is the coefficient of inbreeding the foal would have
+	COI    float64
+	Common []*CommonAncestor
+	Risks  []Risk
+	// Colors is nil when neither parent has a recorded color genotype
+	Colors *coatcolor.Prediction
+}
+
+func (p *Pairing) COIPercent() string {
+	return fmt.Sprintf("%.2f%%", p.COI*100)
+}
+
+// HasDanger reports whether any risk should rule the pairing out.
+func (p *Pairing) HasDanger() bool {
+	return slices.ContainsFunc(p.Risks, func(r Risk) bool { return r.Level == RiskDanger })
+}
+
+// getAncestorsByID returns the horses and external ancestors with the
+// given IDs, by ID.
+func getAncestorsByID(ctx context.Context, db *database.DB, ids []uuid.UUID) (map[uuid.UUID]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.getAncestorsByID")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n WHERE id = ANY($1)`,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ancestors: %w", err)
+	}
+	ancestors, err := scanAncestors(rows)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*Ancestor, len(ancestors))
+	for _, a := range ancestors {
+		byID[a.ID] = a
+	}
+	return byID, nil
+}
+
+// PlanPairings predicts breeding dam to each of sires. The pedigrees are
+// loaded once, so ranking every stallion on a farm costs a few queries.
+func PlanPairings(ctx context.Context, db *database.DB, dam *Ancestor, sires []*Ancestor) ([]*Pairing, error) {
+	defer metrics.TimeQuery("horse.PlanPairings")()
+
+	ids := []uuid.UUID{dam.ID}
+	for _, s := range sires {
+		ids = append(ids, s.ID)
+	}
+	pedigree, err := GetLineage(ctx, db, ids...)
+	if err != nil {
+		return nil, err
+	}
+	calc := inbreeding.New(pedigree, inbreeding.DefaultGenerations)
+
+	pairings := make([]*Pairing, len(sires))
+	var commonIDs []uuid.UUID
+	results := make([]inbreeding.Result, len(sires))
+	for i, s := range sires {
+		results[i] = calc.Mating(s.ID, dam.ID)
+		for _, c := range results[i].Common {
+			commonIDs = append(commonIDs, c.ID)
+		}
+	}
+	names, err := getAncestorsByID(ctx, db, commonIDs)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := GetGeneticStatuses(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range sires {
+		p := &Pairing{Sire: s, Dam: dam, COI: results[i].COI}
+		for _, c := range results[i].Common {
+			a, ok := names[c.ID]
+			if !ok {
+				continue
+			}
+			p.Common = append(p.Common, &CommonAncestor{Ancestor: *a, Contribution: c.Contribution, Paths: c.Paths})
+		}
+		p.Risks = append(pairingRisks(p, pedigree), carrierRisks(statuses[s.ID], statuses[dam.ID])...)
+		if len(s.Genotype) > 0 || len(dam.Genotype) > 0 {
+			p.Colors = coatcolor.Predict(s.Genotype, dam.Genotype)
+		}
+		pairings[i] = p
+	}
+	return pairings, nil
+}
+
+// pairingRisks flags close relationships and high coefficients. Carrier
+// status is flagged separately by carrierRisks.
+func pairingRisks(p *Pairing, pedigree inbreeding.Pedigree) []Risk {
+	var risks []Risk
+	sire, dam := pedigree[p.Sire.ID], pedigree[p.Dam.ID]
+	switch {
+	case sire.Sire == p.Dam.ID || sire.Dam == p.Dam.ID || dam.Sire == p.Sire.ID || dam.Dam == p.Sire.ID:
+		risks = append(risks, Risk{Level: RiskDanger, Message: "Parent and offspring"})
+	case sire.Sire != uuid.Nil && sire.Sire == dam.Sire && sire.Dam != uuid.Nil && sire.Dam == dam.Dam:
+		risks = append(risks, Risk{Level: RiskDanger, Message: "Full siblings"})
+	case (sire.Sire != uuid.Nil && sire.Sire == dam.Sire) || (sire.Dam != uuid.Nil && sire.Dam == dam.Dam):
+		risks = append(risks, Risk{Level: RiskWarning, Message: "Half siblings"})
+	}
+	switch {
+	case p.COI >= highCOI:
+		risks = append(risks, Risk{Level: RiskDanger, Message: fmt.Sprintf("Foal COI of %s is high", p.COIPercent())})
+	case p.COI >= elevatedCOI:
+		risks = append(risks, Risk{Level: RiskWarning, Message: fmt.Sprintf("Foal COI of %s is elevated", p.COIPercent())})
+	}
+	return risks
+}
+
+// RankStallions predicts breeding the mare to every stallion and ridgling
+// in its farm's inventory, from the lowest coefficient of inbreeding up.
+func RankStallions(ctx context.Context, db *database.DB, mare *Ancestor) ([]*Pairing, error) {
+	defer metrics.TimeQuery("horse.RankStallions")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		WHERE farm_id = $1 AND NOT external AND gender IN ($2, $3)
+		AND id IN (SELECT id FROM horses WHERE farm_id = $1 AND status = ANY($4))
+		ORDER BY name`,
+		mare.FarmID,         // $1
+		GenderStallion,      // $2
+		GenderRidgling,      // $3
+		inventoryStatuses(), // $4
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stallions: %w", err)
+	}
+	stallions, err := scanAncestors(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(stallions) == 0 {
+		return nil, nil
+	}
+	pairings, err := PlanPairings(ctx, db, mare, stallions)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(pairings, func(a, b *Pairing) int {
+		if a.HasDanger() != b.HasDanger() {
+			if a.HasDanger() {
+				return 1
+			}
+			return -1
+		}
+		return cmp.Compare(a.COI, b.COI)
+	})
+	return pairings, nil
+}
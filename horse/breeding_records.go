@@ -0,0 +1,133 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// BreedingRecord is a cover of one of the farm's mares by a stallion, one
+// of the farm's horses or an external ancestor.
+type BreedingRecord struct {
+	ID        uuid.UUID `db:"id"`
+	FarmID    uuid.UUID `db:"farm_id"`
+	MareID    uuid.UUID `db:"mare_id"`
+	SireID    uuid.UUID `db:"sire_id"`
+	CoveredOn time.Time `db:"covered_on"`
+	Note      string    `db:"note"`
+	CreatedAt time.Time `db:"created_at"`
+	Mare      *Ancestor `db:"-"`
+	// Sire is nil once the stallion's record has been deleted
+	Sire *Ancestor `db:"-"`
+	// Risks are the carrier warnings for the pairing, from each parent's
+	// latest test results, so they follow tests added after the cover
+	Risks []Risk `db:"-"`
+}
+
+const breedingRecordColumns = `id, farm_id, mare_id, sire_id, covered_on, note, created_at`
+
+// ErrInvalidBreedingRecord is returned for a cover of anything but one of
+// the farm's mares by a stallion or ridgling of the same farm, or dated in
+// the future.
+var ErrInvalidBreedingRecord = errors.New("invalid breeding record")
+
+// AddBreedingRecord records mare being covered by sire on coveredOn.
+func AddBreedingRecord(ctx context.Context, db *database.DB, mare, sire *Ancestor, coveredOn time.Time, note string) (*BreedingRecord, error) {
+	defer metrics.TimeQuery("horse.AddBreedingRecord")()
+
+	if !mare.CanDam() || mare.External || !sire.Gender.IsEntire() || sire.FarmID != mare.FarmID {
+		return nil, ErrInvalidBreedingRecord
+	}
+	if coveredOn.IsZero() || coveredOn.After(time.Now()) {
+		return nil, ErrInvalidBreedingRecord
+	}
+	r := &BreedingRecord{
+		FarmID:    mare.FarmID,
+		MareID:    mare.ID,
+		SireID:    sire.ID,
+		CoveredOn: coveredOn,
+		Note:      note,
+		Mare:      mare,
+		Sire:      sire,
+	}
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO breeding_records (farm_id, mare_id, sire_id, covered_on, note)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		r.FarmID,    // $1
+		r.MareID,    // $2
+		r.SireID,    // $3
+		r.CoveredOn, // $4
+		r.Note,      // $5
+	)
+	if err := row.Scan(&r.ID, &r.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to insert breeding record: %w", err)
+	}
+	return r, nil
+}
+
+// GetBreedingRecords returns the farm's covers, the most recent first,
+// with the carrier warnings for each pairing.
+func GetBreedingRecords(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*BreedingRecord, error) {
+	defer metrics.TimeQuery("horse.GetBreedingRecords")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+breedingRecordColumns+` FROM breeding_records
+		WHERE farm_id = $1 ORDER BY covered_on DESC, created_at DESC`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query breeding records: %w", err)
+	}
+	records, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[BreedingRecord])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect breeding records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var ids []uuid.UUID
+	for _, r := range records {
+		ids = append(ids, r.MareID, r.SireID)
+	}
+	ancestors, err := getAncestorsByID(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := GetGeneticStatuses(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		r.Mare = ancestors[r.MareID]
+		r.Sire = ancestors[r.SireID]
+		r.Risks = carrierRisks(statuses[r.SireID], statuses[r.MareID])
+	}
+	return records, nil
+}
+
+// DeleteBreedingRecord removes one of the farm's covers. It reports false
+// if the farm has no such record.
+func DeleteBreedingRecord(ctx context.Context, db *database.DB, farmID, recordID uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("horse.DeleteBreedingRecord")()
+
+	tag, err := db.Exec(
+		ctx,
+		`DELETE FROM breeding_records WHERE id = $1 AND farm_id = $2`,
+		recordID,
+		farmID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete breeding record: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
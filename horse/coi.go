@@ -0,0 +1,184 @@
+package horse
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/inbreeding"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// CommonAncestor is an ancestor on both sides of a horse's pedigree, with
+// its share of the horse's coefficient of inbreeding.
+type CommonAncestor struct {
+	Ancestor
+	Contribution float64 `db:"contribution"`
+	Paths        int     `db:"paths"`
+}
+
+func (c *CommonAncestor) ContributionPercent() string {
+	return fmt.Sprintf("%.2f%%", c.Contribution*100)
+}
+
+// GetLineage returns the parents of the horses or external ancestors with
+// the given IDs and of all their recorded ancestors. UNION visits each
+// ancestor once however often it recurs in the pedigree.
+func GetLineage(ctx context.Context, db database.Querier, ids ...uuid.UUID) (inbreeding.Pedigree, error) {
+	defer metrics.TimeQuery("horse.GetLineage")()
+
+	rows, err := db.Query(
+		ctx,
+		`WITH RECURSIVE nodes AS (
+			SELECT id, sire_id, dam_id FROM `+pedigreeNodes+` AS n
+		), lineage AS (
+			SELECT id, sire_id, dam_id FROM nodes WHERE id = ANY($1)
+			UNION
+			SELECT parent.id, parent.sire_id, parent.dam_id
+			FROM lineage JOIN nodes parent ON parent.id = lineage.sire_id OR parent.id = lineage.dam_id
+		)
+		SELECT id, sire_id, dam_id FROM lineage`,
+		ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lineage: %w", err)
+	}
+	defer rows.Close()
+
+	pedigree := inbreeding.Pedigree{}
+	for rows.Next() {
+		var id uuid.UUID
+		var p inbreeding.Parents
+		if err := rows.Scan(&id, &p.Sire, &p.Dam); err != nil {
+			return nil, fmt.Errorf("failed to scan lineage: %w", err)
+		}
+		pedigree[id] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return pedigree, nil
+}
+
+// getDescendantHorses returns the IDs of the horses descended from id,
+// including id itself if it is a horse rather than an external ancestor.
+func getDescendantHorses(ctx context.Context, db *database.DB, id uuid.UUID) ([]uuid.UUID, error) {
+	defer metrics.TimeQuery("horse.getDescendantHorses")()
+
+	rows, err := db.Query(
+		ctx,
+		`WITH RECURSIVE nodes AS (
+			SELECT id, sire_id, dam_id FROM `+pedigreeNodes+` AS n
+		), descendants (id) AS (
+			SELECT $1::UUID
+			UNION
+			SELECT child.id
+			FROM descendants JOIN nodes child ON child.sire_id = descendants.id OR child.dam_id = descendants.id
+		)
+		SELECT h.id FROM descendants d JOIN horses h ON h.id = d.id`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query descendants: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect descendants: %w", err)
+	}
+	return ids, nil
+}
+
+// ComputeCOI recomputes and caches the coefficients of inbreeding of the
+// horse or external ancestor with the given ID and of every horse
+// descended from it, whose coefficients depend on its pedigree.
+func ComputeCOI(ctx context.Context, db *database.DB, id uuid.UUID) error {
+	defer metrics.TimeQuery("horse.ComputeCOI")()
+
+	horseIDs, err := getDescendantHorses(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if len(horseIDs) == 0 {
+		return nil
+	}
+	pedigree, err := GetLineage(ctx, db, horseIDs...)
+	if err != nil {
+		return err
+	}
+	calc := inbreeding.New(pedigree, inbreeding.DefaultGenerations)
+	for _, horseID := range horseIDs {
+		if err := saveCOI(ctx, db, horseID, calc.Horse(horseID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveCOI(ctx context.Context, db *database.DB, horseID uuid.UUID, r inbreeding.Result) error {
+	ancestorIDs := make([]uuid.UUID, len(r.Common))
+	contributions := make([]float64, len(r.Common))
+	paths := make([]int32, len(r.Common))
+	for i, c := range r.Common {
+		ancestorIDs[i] = c.ID
+		contributions[i] = c.Contribution
+		paths[i] = int32(c.Paths)
+	}
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE horses SET coi = $2, coi_generations = $3, coi_computed_at = now() WHERE id = $1`,
+			horseID,                       // $1
+			r.COI,                         // $2
+			inbreeding.DefaultGenerations, // $3
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update coi: %w", err)
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM horse_common_ancestors WHERE horse_id = $1`, horseID)
+		if err != nil {
+			return fmt.Errorf("failed to clear common ancestors: %w", err)
+		}
+		if len(r.Common) == 0 {
+			return nil
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO horse_common_ancestors (horse_id, ancestor_id, contribution, paths)
+			SELECT $1, unnest($2::UUID[]), unnest($3::FLOAT8[]), unnest($4::INT[])`,
+			horseID,       // $1
+			ancestorIDs,   // $2
+			contributions, // $3
+			paths,         // $4
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert common ancestors: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetCommonAncestors returns the cached common ancestors of the horse, from
+// the largest contribution to its coefficient down.
+func GetCommonAncestors(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*CommonAncestor, error) {
+	defer metrics.TimeQuery("horse.GetCommonAncestors")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+prefixColumns("n", ancestorColumns)+`, c.contribution, c.paths
+		FROM horse_common_ancestors c JOIN `+pedigreeNodes+` AS n ON n.id = c.ancestor_id
+		WHERE c.horse_id = $1
+		ORDER BY c.contribution DESC, n.name`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query common ancestors: %w", err)
+	}
+	common, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[CommonAncestor])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect common ancestors: %w", err)
+	}
+	return common, nil
+}
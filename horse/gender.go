@@ -1,5 +1,7 @@
 package horse
 
+import "time"
+
 type Gender int
 
 const (
@@ -7,19 +9,49 @@ const (
 	GenderStallion
 	GenderGelding
 	GenderMare
+	// GenderRidgling is a cryptorchid male, one or both of whose testicles
+	// have not descended
+	GenderRidgling
 )
 
-var ValidGenders = []Gender{GenderStallion, GenderGelding, GenderMare}
+var ValidGenders = []Gender{GenderStallion, GenderGelding, GenderMare, GenderRidgling}
 
 func (g Gender) IsInvalid() bool {
 	return g < 1 || int(g) > len(ValidGenders)
 }
 
-// A horse is a filly or colt when they are less than 4 years old
-const maxYouthAge = 3
+// String names the gender regardless of age; see Horse.GenderString.
+func (g Gender) String() string {
+	switch g {
+	case GenderStallion:
+		return "Stallion"
+	case GenderGelding:
+		return "Gelding"
+	case GenderMare:
+		return "Mare"
+	case GenderRidgling:
+		return "Ridgling"
+	}
+	return ""
+}
+
+// IsEntire reports whether the gender is an uncastrated male, which may be
+// bred as a sire.
+func (g Gender) IsEntire() bool {
+	return g == GenderStallion || g == GenderRidgling
+}
+
+// CanBecome reports whether a horse may be reclassified from g to to:
+// gelding a stallion or ridgling, or correcting one to the other once a
+// vet has examined it.
+func (g Gender) CanBecome(to Gender) bool {
+	return g.IsEntire() && (to == GenderGelding || to.IsEntire()) && g != to
+}
 
+// GenderString names the gender as it suits the horse's age: a colt or
+// filly until the farm's age of maturity.
 func (h *Horse) GenderString() string {
-	isYouth := h.Age() < maxYouthAge
+	isYouth := h.Rules.IsYouth(h.Birth, time.Now())
 	switch h.Gender {
 	case GenderStallion:
 		if isYouth {
@@ -36,6 +68,11 @@ func (h *Horse) GenderString() string {
 			return "Filly"
 		}
 		return "Mare"
+	case GenderRidgling:
+		if isYouth {
+			return "Ridgling Colt"
+		}
+		return "Ridgling"
 	}
 	return ""
 }
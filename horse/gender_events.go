@@ -0,0 +1,119 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// GenderEvent is a dated change of a horse's sex classification.
+type GenderEvent struct {
+	ID        uuid.UUID `db:"id"`
+	HorseID   uuid.UUID `db:"horse_id"`
+	From      Gender    `db:"from_gender"`
+	To        Gender    `db:"to_gender"`
+	ChangedOn time.Time `db:"changed_on"`
+	Note      string    `db:"note"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func (e *GenderEvent) Description() string {
+	if e.To == GenderGelding {
+		return fmt.Sprintf("Gelded (previously %s)", e.From)
+	}
+	return fmt.Sprintf("Reclassified from %s to %s", e.From, e.To)
+}
+
+// ErrInvalidGenderChange is returned for a change Gender.CanBecome does not
+// allow, or dated in the future, before the horse was born or before its
+// last change of sex.
+var ErrInvalidGenderChange = errors.New("invalid change of sex")
+
+// ChangeGender reclassifies h as of changedOn, recording the change so the
+// horse's earlier classification stays on its record.
+func ChangeGender(ctx context.Context, db *database.DB, h *Horse, to Gender, changedOn time.Time, note string) error {
+	defer metrics.TimeQuery("horse.ChangeGender")()
+
+	if !h.Gender.CanBecome(to) || changedOn.After(time.Now()) {
+		return ErrInvalidGenderChange
+	}
+	if h.Birth.IsKnown() && changedOn.Before(h.Birth.Date) {
+		return ErrInvalidGenderChange
+	}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// History must read in order, so a change can't predate the last
+		var last *time.Time
+		err := tx.QueryRow(
+			ctx,
+			`SELECT max(changed_on) FROM horse_gender_events WHERE horse_id = $1`,
+			h.ID,
+		).Scan(&last)
+		if err != nil {
+			return fmt.Errorf("failed to get last gender change: %w", err)
+		}
+		if last != nil && changedOn.Before(*last) {
+			return ErrInvalidGenderChange
+		}
+		// Checking the old gender stops two changes racing
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE horses SET gender = $3 WHERE id = $1 AND gender = $2`,
+			h.ID,     // $1
+			h.Gender, // $2
+			to,       // $3
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update gender: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidGenderChange
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO horse_gender_events (horse_id, from_gender, to_gender, changed_on, note)
+			VALUES ($1, $2, $3, $4, $5)`,
+			h.ID,      // $1
+			h.Gender,  // $2
+			to,        // $3
+			changedOn, // $4
+			note,      // $5
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert gender event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.Gender = to
+	return nil
+}
+
+// GetGenderHistory returns the horse's changes of sex classification, the
+// earliest first.
+func GetGenderHistory(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*GenderEvent, error) {
+	defer metrics.TimeQuery("horse.GetGenderHistory")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, horse_id, from_gender, to_gender, changed_on, note, created_at
+		FROM horse_gender_events WHERE horse_id = $1 ORDER BY changed_on, created_at`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gender history: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[GenderEvent])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect gender history: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,284 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+	"github.com/DevonFarm/sales/storage"
+)
+
+// Condition is a recessive inherited disorder horses are tested for.
+type Condition string
+
+const (
+	ConditionDwarfism      Condition = "dwarfism"
+	ConditionHydrocephalus Condition = "hydrocephalus"
+)
+
+// Conditions lists every Condition, in the order a form should offer them.
+var Conditions = []Condition{ConditionDwarfism, ConditionHydrocephalus}
+
+func (c Condition) IsValid() bool {
+	return slices.Contains(Conditions, c)
+}
+
+func (c Condition) Label() string {
+	switch c {
+	case ConditionDwarfism:
+		return "Dwarfism"
+	case ConditionHydrocephalus:
+		return "Hydrocephalus"
+	}
+	return string(c)
+}
+
+// TestResult is how many copies of a condition's variant a horse carries.
+type TestResult string
+
+const (
+	ResultClear    TestResult = "clear"
+	ResultCarrier  TestResult = "carrier"
+	ResultAffected TestResult = "affected"
+)
+
+var TestResults = []TestResult{ResultClear, ResultCarrier, ResultAffected}
+
+func (r TestResult) IsValid() bool {
+	return slices.Contains(TestResults, r)
+}
+
+func (r TestResult) Label() string {
+	switch r {
+	case ResultClear:
+		return "Clear (N/N)"
+	case ResultCarrier:
+		return "Carrier (N/x)"
+	case ResultAffected:
+		return "Affected (x/x)"
+	}
+	return string(r)
+}
+
+// transmission is the chance a horse passes the variant to a foal.
+func (r TestResult) transmission() float64 {
+	switch r {
+	case ResultCarrier:
+		return 0.5
+	case ResultAffected:
+		return 1
+	}
+	return 0
+}
+
+type GeneticTest struct {
+	ID        uuid.UUID  `db:"id"`
+	HorseID   uuid.UUID  `db:"horse_id"`
+	Condition Condition  `db:"condition"`
+	Result    TestResult `db:"result"`
+	Lab       string     `db:"lab"`
+	TestedOn  time.Time  `db:"tested_on"`
+	// DocumentID is the uploaded certificate, uuid.Nil when there is none
+	// or it has been deleted
+	DocumentID uuid.UUID `db:"document_id"`
+	// Public tests are shown on the horse's public listing
+	Public    bool      `db:"public"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const geneticTestColumns = `id, horse_id, condition, result, lab, tested_on, document_id, public, created_at`
+
+func (t *GeneticTest) HasCertificate() bool {
+	return t.DocumentID != uuid.Nil
+}
+
+// ErrInvalidTest is returned for a test with an unknown condition or
+// result, or without a date.
+var ErrInvalidTest = errors.New("invalid genetic test")
+
+// AddGeneticTest records a test result for h. The certificate, if given,
+// is stored as one of the horse's documents.
+func AddGeneticTest(ctx context.Context, db *database.DB, store storage.Store, h *Horse, t *GeneticTest, certificate *multipart.FileHeader) error {
+	defer metrics.TimeQuery("horse.AddGeneticTest")()
+
+	if !t.Condition.IsValid() || !t.Result.IsValid() || t.TestedOn.IsZero() {
+		return ErrInvalidTest
+	}
+	t.ID = uuid.New()
+	t.HorseID = h.ID
+	if certificate != nil {
+		doc, err := AddDocument(ctx, db, store, h, certificate)
+		if err != nil {
+			return err
+		}
+		t.DocumentID = doc.ID
+	}
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO horse_genetic_tests (id, horse_id, condition, result, lab, tested_on, document_id, public)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, $8), $9) RETURNING created_at`,
+		t.ID,         // $1
+		t.HorseID,    // $2
+		t.Condition,  // $3
+		t.Result,     // $4
+		t.Lab,        // $5
+		t.TestedOn,   // $6
+		t.DocumentID, // $7
+		uuid.Nil,     // $8
+		t.Public,     // $9
+	)
+	if err := row.Scan(&t.CreatedAt); err != nil {
+		if t.HasCertificate() {
+			if _, delErr := DeleteDocument(ctx, db, store, h.ID, t.DocumentID); delErr != nil {
+				return fmt.Errorf("failed to insert genetic test: %w", errors.Join(err, delErr))
+			}
+		}
+		return fmt.Errorf("failed to insert genetic test: %w", err)
+	}
+	return nil
+}
+
+// GetGeneticTests returns the horse's tests, the most recent first.
+func GetGeneticTests(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*GeneticTest, error) {
+	defer metrics.TimeQuery("horse.GetGeneticTests")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+geneticTestColumns+` FROM horse_genetic_tests
+		WHERE horse_id = $1 ORDER BY tested_on DESC, created_at DESC`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query genetic tests: %w", err)
+	}
+	tests, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[GeneticTest])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect genetic tests: %w", err)
+	}
+	return tests, nil
+}
+
+// DeleteGeneticTest removes one of the horse's tests, leaving its
+// certificate among the horse's documents. It reports false if the horse
+// has no such test.
+func DeleteGeneticTest(ctx context.Context, db *database.DB, horseID, testID uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("horse.DeleteGeneticTest")()
+
+	tag, err := db.Exec(
+		ctx,
+		`DELETE FROM horse_genetic_tests WHERE id = $1 AND horse_id = $2`,
+		testID,
+		horseID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete genetic test: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// LoadPublicGeneticTests sets the public tests of each of the horses: for
+// each condition, the latest test if the farm made it public. An older
+// public result is not shown in place of a newer private one.
+func LoadPublicGeneticTests(ctx context.Context, db *database.DB, horses []*Horse) error {
+	defer metrics.TimeQuery("horse.LoadPublicGeneticTests")()
+
+	ids := make([]uuid.UUID, len(horses))
+	for i, h := range horses {
+		ids[i] = h.ID
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+geneticTestColumns+` FROM (
+			SELECT DISTINCT ON (horse_id, condition) `+geneticTestColumns+`
+			FROM horse_genetic_tests WHERE horse_id = ANY($1)
+			ORDER BY horse_id, condition, tested_on DESC, created_at DESC
+		) AS latest
+		WHERE public
+		ORDER BY horse_id, condition`,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to query public genetic tests: %w", err)
+	}
+	tests, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[GeneticTest])
+	if err != nil {
+		return fmt.Errorf("failed to collect public genetic tests: %w", err)
+	}
+	byHorse := map[uuid.UUID][]*GeneticTest{}
+	for _, t := range tests {
+		byHorse[t.HorseID] = append(byHorse[t.HorseID], t)
+	}
+	for _, h := range horses {
+		h.PublicTests = byHorse[h.ID]
+	}
+	return nil
+}
+
+// GeneticStatus maps each condition a horse was tested for to its latest
+// result.
+type GeneticStatus map[Condition]TestResult
+
+// GetGeneticStatuses returns the genetic status of each of the given
+// horses that has been tested. A later test supersedes an earlier one.
+func GetGeneticStatuses(ctx context.Context, db *database.DB, horseIDs []uuid.UUID) (map[uuid.UUID]GeneticStatus, error) {
+	defer metrics.TimeQuery("horse.GetGeneticStatuses")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT DISTINCT ON (horse_id, condition) horse_id, condition, result
+		FROM horse_genetic_tests WHERE horse_id = ANY($1)
+		ORDER BY horse_id, condition, tested_on DESC, created_at DESC`,
+		horseIDs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query genetic statuses: %w", err)
+	}
+	defer rows.Close()
+
+	statuses := map[uuid.UUID]GeneticStatus{}
+	for rows.Next() {
+		var horseID uuid.UUID
+		var c Condition
+		var r TestResult
+		if err := rows.Scan(&horseID, &c, &r); err != nil {
+			return nil, fmt.Errorf("failed to scan genetic status: %w", err)
+		}
+		if statuses[horseID] == nil {
+			statuses[horseID] = GeneticStatus{}
+		}
+		statuses[horseID][c] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return statuses, nil
+}
+
+// carrierRisks flags conditions a foal of sire and dam could be affected
+// by. Untested conditions are not flagged.
+func carrierRisks(sire, dam GeneticStatus) []Risk {
+	var risks []Risk
+	for _, c := range Conditions {
+		chance := sire[c].transmission() * dam[c].transmission()
+		if chance == 0 {
+			continue
+		}
+		level := RiskWarning
+		if chance >= 0.5 {
+			level = RiskDanger
+		}
+		risks = append(risks, Risk{
+			Level:   level,
+			Message: fmt.Sprintf("Both parents carry %s: %.0f%% chance of an affected foal", c.Label(), chance*100),
+		})
+	}
+	return risks
+}
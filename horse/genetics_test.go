@@ -0,0 +1,83 @@
+package horse
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCarrierRisks(t *testing.T) {
+	tests := []struct {
+		name      string
+		sire, dam GeneticStatus
+		want      []Risk
+	}{
+		{name: "untested", want: nil},
+		{
+			name: "one carrier",
+			sire: GeneticStatus{ConditionDwarfism: ResultCarrier},
+			dam:  GeneticStatus{ConditionDwarfism: ResultClear},
+			want: nil,
+		},
+		{
+			name: "carrier untested",
+			sire: GeneticStatus{ConditionDwarfism: ResultCarrier},
+			want: nil,
+		},
+		{
+			name: "both carriers",
+			sire: GeneticStatus{ConditionDwarfism: ResultCarrier},
+			dam:  GeneticStatus{ConditionDwarfism: ResultCarrier, ConditionHydrocephalus: ResultCarrier},
+			want: []Risk{{Level: RiskWarning, Message: "Both parents carry Dwarfism: 25% chance of an affected foal"}},
+		},
+		{
+			name: "carrier and affected",
+			sire: GeneticStatus{ConditionHydrocephalus: ResultAffected},
+			dam:  GeneticStatus{ConditionHydrocephalus: ResultCarrier},
+			want: []Risk{{Level: RiskDanger, Message: "Both parents carry Hydrocephalus: 50% chance of an affected foal"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := carrierRisks(tt.sire, tt.dam)
+			if len(got) != len(tt.want) {
+				t.Fatalf("carrierRisks() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("carrierRisks()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAddBreedingRecordRejects(t *testing.T) {
+	farmID := uuid.New()
+	mare := &Ancestor{ID: uuid.New(), FarmID: farmID, Gender: GenderMare}
+	stallion := &Ancestor{ID: uuid.New(), FarmID: farmID, Gender: GenderStallion}
+	yesterday := time.Now().AddDate(0, 0, -1)
+	tests := []struct {
+		name      string
+		mare      *Ancestor
+		sire      *Ancestor
+		coveredOn time.Time
+	}{
+		{name: "mare is a stallion", mare: stallion, sire: stallion, coveredOn: yesterday},
+		{name: "external mare", mare: &Ancestor{ID: uuid.New(), FarmID: farmID, Gender: GenderMare, External: true}, sire: stallion, coveredOn: yesterday},
+		{name: "gelding", mare: mare, sire: &Ancestor{ID: uuid.New(), FarmID: farmID, Gender: GenderGelding}, coveredOn: yesterday},
+		{name: "other farm's stallion", mare: mare, sire: &Ancestor{ID: uuid.New(), FarmID: uuid.New(), Gender: GenderStallion}, coveredOn: yesterday},
+		{name: "future", mare: mare, sire: stallion, coveredOn: time.Now().AddDate(0, 0, 1)},
+		{name: "no date", mare: mare, sire: stallion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Invalid records are refused before the database is used
+			if _, err := AddBreedingRecord(t.Context(), nil, tt.mare, tt.sire, tt.coveredOn, ""); !errors.Is(err, ErrInvalidBreedingRecord) {
+				t.Errorf("AddBreedingRecord() error = %v, want ErrInvalidBreedingRecord", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package horse
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	cmPerInch = 2.54
+	// A hand is four inches
+	cmPerHand = 4 * cmPerInch
+)
+
+// Height is a height at the withers in hands, as a plain number: 15.2 hh,
+// fifteen hands two inches, is 15.5. Zero means unmeasured.
+type Height float64
+
+var ErrInvalidHeight = errors.New(`height must be in hands, such as "15.2", or centimetres, such as "157cm"`)
+
+// ParseHeight reads a height in hands notation, where the digit after the
+// point counts inches, or in centimetres with a "cm" suffix. Centimetres are
+// rounded to the nearest inch, so both forms of a height compare equal. An
+// empty string is an unmeasured height.
+func ParseHeight(s string) (Height, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	if cm, ok := strings.CutSuffix(s, "cm"); ok {
+		v, err := strconv.ParseFloat(strings.TrimSpace(cm), 64)
+		if err != nil || v <= 0 {
+			return 0, ErrInvalidHeight
+		}
+		inches := math.Round(v / cmPerInch)
+		if inches == 0 {
+			return 0, ErrInvalidHeight
+		}
+		return Height(inches / 4), nil
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "hh"), "h"))
+	hands, inches, _ := strings.Cut(s, ".")
+	h, err := strconv.Atoi(hands)
+	if err != nil || h <= 0 {
+		return 0, ErrInvalidHeight
+	}
+	in := 0
+	if inches != "" {
+		in, err = strconv.Atoi(inches)
+		if err != nil || in < 0 || in > 3 {
+			return 0, ErrInvalidHeight
+		}
+	}
+	return Height(float64(h) + float64(in)/4), nil
+}
+
+func (h Height) IsZero() bool {
+	return h == 0
+}
+
+// Hands writes the height in hands notation, such as "15.2".
+func (h Height) Hands() string {
+	if h.IsZero() {
+		return ""
+	}
+	inches := int(math.Round(float64(h) * 4))
+	return fmt.Sprintf("%d.%d", inches/4, inches%4)
+}
+
+func (h Height) Centimetres() int {
+	return int(math.Round(float64(h) * cmPerHand))
+}
+
+// String writes the height in both units, such as "15.2 hh (157 cm)".
+func (h Height) String() string {
+	if h.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s hh (%d cm)", h.Hands(), h.Centimetres())
+}
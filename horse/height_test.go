@@ -0,0 +1,69 @@
+package horse
+
+import "testing"
+
+func TestParseHeight(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantHands string
+		wantCM    int
+		wantErr   bool
+	}{
+		{input: "15.2", wantHands: "15.2", wantCM: 157},
+		{input: "157cm", wantHands: "15.2", wantCM: 157},
+		{input: "157 CM", wantHands: "15.2", wantCM: 157},
+		{input: "16hh", wantHands: "16.0", wantCM: 163},
+		{input: "14.3h", wantHands: "14.3", wantCM: 150},
+		{input: "", wantHands: "", wantCM: 0},
+		{input: "15.4", wantErr: true},
+		{input: "0cm", wantErr: true},
+		{input: "1cm", wantErr: true},
+		{input: "-15", wantErr: true},
+		{input: "tall", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			h, err := ParseHeight(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHeight(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := h.Hands(); got != tt.wantHands {
+				t.Errorf("ParseHeight(%q).Hands() = %q, want %q", tt.input, got, tt.wantHands)
+			}
+			if got := h.Centimetres(); got != tt.wantCM {
+				t.Errorf("ParseHeight(%q).Centimetres() = %d, want %d", tt.input, got, tt.wantCM)
+			}
+		})
+	}
+}
+
+func TestParseHeightCentimetresMatchHands(t *testing.T) {
+	tests := []struct {
+		cm    string
+		hands string
+	}{
+		{cm: "157cm", hands: "15.2"},
+		{cm: "158cm", hands: "15.2"},
+		{cm: "163cm", hands: "16"},
+		{cm: "150cm", hands: "14.3"},
+		{cm: "147.3cm", hands: "14.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cm, func(t *testing.T) {
+			fromCM, err := ParseHeight(tt.cm)
+			if err != nil {
+				t.Fatalf("ParseHeight(%q): %v", tt.cm, err)
+			}
+			fromHands, err := ParseHeight(tt.hands)
+			if err != nil {
+				t.Fatalf("ParseHeight(%q): %v", tt.hands, err)
+			}
+			if fromCM != fromHands {
+				t.Errorf("ParseHeight(%q) = %v, want exactly ParseHeight(%q) = %v", tt.cm, float64(fromCM), tt.hands, float64(fromHands))
+			}
+		})
+	}
+}
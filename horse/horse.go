@@ -3,12 +3,17 @@ package horse
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/farm"
+	"github.com/DevonFarm/sales/lifestage"
+	"github.com/DevonFarm/sales/metrics"
 
 	"github.com/google/uuid"
 	"github.com/iancoleman/strcase"
+	"github.com/jackc/pgx/v5"
 )
 
 type Horse struct {
@@ -16,59 +21,232 @@ type Horse struct {
 	Name        string    `db:"name" form:"name"`
 	Description string    `db:"description" form:"description"`
 	Images      []*Image
-	DateOfBirth time.Time `db:"date_of_birth" form:"-"`
-	Gender      Gender    `db:"gender" form:"gender"`
-	FarmID      uuid.UUID `db:"farm_id" form:"-"`
+	// Cover is the first processed image, shown on the dashboard card
+	Cover  *Image
+	Birth  lifestage.BirthDate `form:"-"`
+	Gender Gender              `db:"gender" form:"gender"`
+	FarmID uuid.UUID           `db:"farm_id" form:"-"`
+	// SireID and DamID point at a horse or an external ancestor, and are
+	// uuid.Nil when the parent is unknown
+	SireID uuid.UUID `db:"sire_id" form:"-"`
+	DamID  uuid.UUID `db:"dam_id" form:"-"`
+	// COI is the cached coefficient of inbreeding, nil until computed
+	COI      *float64 `db:"coi" form:"-"`
+	Color    string   `db:"color" form:"color"`
+	Markings string   `db:"markings" form:"markings"`
+	Height   Height   `db:"height_hands" form:"-"`
+	Status   Status   `db:"status" form:"-"`
+	// Breeds are the horse's breed shares, from the largest down
+	Breeds []*BreedShare
+	// PublicTests are the genetic test results shown on public listings,
+	// loaded only for them
+	PublicTests []*GeneticTest
+	// Rules are the farm's life stage rules, loaded with the horse
+	Rules lifestage.Rules `json:"-"`
 }
 
-func (h *Horse) Age() int {
-	return int(time.Since(h.DateOfBirth).Hours() / 24 / 365)
+func (h *Horse) HasBothParents() bool {
+	return h.SireID != uuid.Nil && h.DamID != uuid.Nil
 }
 
-func (h *Horse) HTMLPath() string {
-	return fmt.Sprintf("%s.html", strcase.ToSnake(h.Name))
+// COIPercent formats the coefficient of inbreeding for display.
+func (h *Horse) COIPercent() string {
+	if h.COI == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f%%", *h.COI*100)
 }
 
-func (h *Horse) NewImage(full, thumbnail, alt string) {
-	prefix := fmt.Sprintf("assets/images/horses/%s", h.Name)
-	img := &Image{
-		Full:      fmt.Sprintf("%s/%s", prefix, full),
-		Thumbnail: fmt.Sprintf("%s/%s", prefix, thumbnail),
-		Alt:       alt,
-	}
-	if h.Images == nil {
-		h.Images = make([]*Image, 0)
-	}
-	h.Images = append(h.Images, img)
+func (h *Horse) Age() lifestage.Age {
+	return h.Rules.AgeAt(h.Birth, time.Now())
+}
+
+func (h *Horse) LifeStage() lifestage.Stage {
+	return h.Rules.StageAt(h.Birth, time.Now())
+}
+
+func (h *Horse) HTMLPath() string {
+	return fmt.Sprintf("%s.html", strcase.ToSnake(h.Name))
 }
 
 func (h *Horse) Save(ctx context.Context, db *database.DB) error {
+	defer metrics.TimeQuery("horse.Save")()
+
 	// Validate horse data
 	if h.Gender.IsInvalid() {
 		return fmt.Errorf("invalid horse gender: %d", h.Gender)
 	}
+	if !h.Birth.Precision.IsValid() {
+		return fmt.Errorf("invalid birth date precision: %s", h.Birth.Precision)
+	}
+	if h.Status == "" {
+		h.Status = StatusActive
+	}
 	row := db.QueryRow(
 		ctx,
-		`INSERT INTO horses (name, description, date_of_birth, gender, farm_id) 
-		VALUES ($1, $2, $3, $4, $5)
+		`INSERT INTO horses (name, description, date_of_birth, birth_date_precision, gender, farm_id, sire_id, dam_id, color, markings, height_hands, status) 
+		VALUES ($1, $2, $3, $12, $4, $5, NULLIF($6, $8), NULLIF($7, $8), $9, $10, $11, $13)
 		RETURNING id`,
-		h.Name,        // $1
-		h.Description, // $2
-		h.DateOfBirth, // $3
-		h.Gender,      // $4
-		h.FarmID,      // $5
+		h.Name,            // $1
+		h.Description,     // $2
+		h.birthDateArg(),  // $3
+		h.Gender,          // $4
+		h.FarmID,          // $5
+		h.SireID,          // $6
+		h.DamID,           // $7
+		uuid.Nil,          // $8
+		h.Color,           // $9
+		h.Markings,        // $10
+		h.Height,          // $11
+		h.Birth.Precision, // $12
+		h.Status,          // $13
 	)
 	if err := row.Scan(&h.ID); err != nil {
 		return fmt.Errorf("failed to scan horse id: %w", err)
 	}
+	metrics.HorsesCreated.Inc()
 	return nil
 }
 
-func GetHorsesByFarmID(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*Horse, error) {
+// birthDateArg is the date_of_birth to store, NULL when unknown.
+func (h *Horse) birthDateArg() *time.Time {
+	if !h.Birth.IsKnown() {
+		return nil
+	}
+	return &h.Birth.Date
+}
+
+// birthDate builds a birth date from its scanned columns.
+func birthDate(dob *time.Time, precision lifestage.Precision) lifestage.BirthDate {
+	b := lifestage.BirthDate{Precision: precision}
+	if dob != nil {
+		b.Date = *dob
+	}
+	return b
+}
+
+func GetHorse(ctx context.Context, db *database.DB, id uuid.UUID) (*Horse, error) {
+	defer metrics.TimeQuery("horse.GetHorse")()
+
+	var h Horse
+	var dob *time.Time
+	var precision lifestage.Precision
+	row := db.QueryRow(
+		ctx,
+		`SELECT h.id, h.name, h.description, h.date_of_birth, h.birth_date_precision, h.gender, h.farm_id, h.sire_id, h.dam_id, h.coi,
+			h.color, h.markings, h.height_hands, h.status, f.registry_aging, f.weaning_months, f.mature_age
+		FROM horses h JOIN farms f ON f.id = h.farm_id WHERE h.id = $1`,
+		id,
+	)
+	if err := row.Scan(
+		&h.ID, &h.Name, &h.Description, &dob, &precision, &h.Gender, &h.FarmID, &h.SireID, &h.DamID, &h.COI,
+		&h.Color, &h.Markings, &h.Height, &h.Status, &h.Rules.RegistryAging, &h.Rules.WeaningMonths, &h.Rules.MatureAge,
+	); err != nil {
+		return nil, fmt.Errorf("failed to get horse: %w", err)
+	}
+	h.Birth = birthDate(dob, precision)
+	if err := loadBreeds(ctx, db, []*Horse{&h}); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// UpdateDetails saves the horse's birth date, color, markings and height,
+// and replaces its breed shares.
+func UpdateDetails(ctx context.Context, db *database.DB, h *Horse) error {
+	defer metrics.TimeQuery("horse.UpdateDetails")()
+
+	if err := validateBreeds(h.Breeds); err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE horses
+			SET color = $2, markings = $3, height_hands = $4, date_of_birth = $5, birth_date_precision = $6
+			WHERE id = $1`,
+			h.ID,              // $1
+			h.Color,           // $2
+			h.Markings,        // $3
+			h.Height,          // $4
+			h.birthDateArg(),  // $5
+			h.Birth.Precision, // $6
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update horse details: %w", err)
+		}
+		return setBreeds(ctx, tx, h.ID, h.Breeds)
+	})
+}
+
+// Filter narrows a farm's horses. Zero fields match every horse.
+type Filter struct {
+	BreedID uuid.UUID
+	// Color matches any part of the recorded color, ignoring case
+	Color     string
+	MinHeight Height
+	MaxHeight Height
+	// Status is empty for the horses in inventory, or StatusAll
+	Status Status
+	Sort   Sort
+}
+
+// StatusAll filters for every horse, sold and deceased ones included.
+const StatusAll Status = "all"
+
+// Sort orders a farm's horses. The zero Sort is by name.
+type Sort string
+
+const (
+	SortName Sort = ""
+	SortAge  Sort = "age"
+)
+
+// IsZero reports whether f matches every horse, whatever its order.
+func (f Filter) IsZero() bool {
+	f.Sort = SortName
+	return f == Filter{}
+}
+
+// GetHorsesByFarmID returns the farm's horses that match f, by name.
+func GetHorsesByFarmID(ctx context.Context, db *database.DB, farmID uuid.UUID, f Filter) ([]*Horse, error) {
+	defer metrics.TimeQuery("horse.GetHorsesByFarmID")()
+
+	return queryHorses(ctx, db, farmID, f)
+}
+
+// GetListings returns the horses for sale on every farm that match f, by
+// name. f's status is ignored.
+func GetListings(ctx context.Context, db *database.DB, f Filter) ([]*Horse, error) {
+	defer metrics.TimeQuery("horse.GetListings")()
+
+	f.Status = StatusForSale
+	return queryHorses(ctx, db, uuid.Nil, f)
+}
+
+// queryHorses returns the horses that match f on the farm, or on every farm
+// when farmID is uuid.Nil.
+func queryHorses(ctx context.Context, db *database.DB, farmID uuid.UUID, f Filter) ([]*Horse, error) {
 	rows, err := db.Query(
 		ctx,
-		`SELECT id, name, description, date_of_birth, gender FROM horses WHERE farm_id = $1 ORDER BY name`,
-		farmID,
+		`SELECT h.id, h.name, h.description, h.date_of_birth, h.birth_date_precision, h.gender, h.farm_id, h.sire_id, h.dam_id, h.coi,
+			h.color, h.markings, h.height_hands, h.status, f.registry_aging, f.weaning_months, f.mature_age
+		FROM horses h JOIN farms f ON f.id = h.farm_id
+		WHERE ($1 = $6 OR h.farm_id = $1)
+		AND ($2 = $6 OR EXISTS (SELECT 1 FROM horse_breeds hb WHERE hb.horse_id = h.id AND hb.breed_id = $2))
+		AND ($3 = '' OR h.color ILIKE '%' || $3 || '%')
+		AND ($4::FLOAT8 = 0 OR h.height_hands >= $4)
+		AND ($5::FLOAT8 = 0 OR h.height_hands <= $5)
+		AND ($7 = 'all' OR ($7 = '' AND h.status = ANY($8)) OR h.status = $7)
+		ORDER BY h.name`,
+		farmID,              // $1
+		f.BreedID,           // $2
+		f.Color,             // $3
+		f.MinHeight,         // $4
+		f.MaxHeight,         // $5
+		uuid.Nil,            // $6
+		f.Status,            // $7
+		inventoryStatuses(), // $8
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query horses: %w", err)
@@ -78,35 +256,90 @@ func GetHorsesByFarmID(ctx context.Context, db *database.DB, farmID uuid.UUID) (
 	var horses []*Horse
 	for rows.Next() {
 		var h Horse
-		if err := rows.Scan(&h.ID, &h.Name, &h.Description, &h.DateOfBirth, &h.Gender); err != nil {
+		var dob *time.Time
+		var precision lifestage.Precision
+		if err := rows.Scan(
+			&h.ID, &h.Name, &h.Description, &dob, &precision, &h.Gender, &h.FarmID, &h.SireID, &h.DamID, &h.COI,
+			&h.Color, &h.Markings, &h.Height, &h.Status, &h.Rules.RegistryAging, &h.Rules.WeaningMonths, &h.Rules.MatureAge,
+		); err != nil {
 			return nil, fmt.Errorf("failed to scan horse: %w", err)
 		}
+		h.Birth = birthDate(dob, precision)
 		horses = append(horses, &h)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
+	if err := loadBreeds(ctx, db, horses); err != nil {
+		return nil, err
+	}
+	if f.Sort == SortAge {
+		sortByAge(horses)
+	}
 	return horses, nil
 }
 
+// sortByAge orders horses from the youngest, comparing partial birth dates
+// by the middle of their period. Horses of unknown age go last.
+func sortByAge(horses []*Horse) {
+	slices.SortStableFunc(horses, func(a, b *Horse) int {
+		if a.Birth.IsKnown() != b.Birth.IsKnown() {
+			if a.Birth.IsKnown() {
+				return -1
+			}
+			return 1
+		}
+		return b.Birth.Midpoint().Compare(a.Birth.Midpoint())
+	})
+}
+
 type DashboardStats struct {
 	TotalHorses int
 	Stallions   int
 	Mares       int
 	Geldings    int
+	Ridglings   int
+	// Stages counts horses by life stage, in the order of the farm's
+	// stages, leaving out stages with none
+	Stages []StageCount
+	// Statuses counts every horse by status, including those out of
+	// inventory that the other counts leave out
+	Statuses []StatusCount
+}
+
+type StatusCount struct {
+	Status Status
+	Count  int
+}
+
+type StageCount struct {
+	Stage lifestage.Stage
+	Count int
 }
 
 func GetDashboardStats(ctx context.Context, db *database.DB, farmID uuid.UUID) (*DashboardStats, error) {
+	defer metrics.TimeQuery("horse.GetDashboardStats")()
+
 	stats := &DashboardStats{}
 
-	// Get total count
-	row := db.QueryRow(ctx, `SELECT COUNT(*) FROM horses WHERE farm_id = $1`, farmID)
+	// Get total count of horses in inventory
+	row := db.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM horses WHERE farm_id = $1 AND status = ANY($2)`,
+		farmID,
+		inventoryStatuses(),
+	)
 	if err := row.Scan(&stats.TotalHorses); err != nil {
 		return nil, fmt.Errorf("failed to get total horses: %w", err)
 	}
 
 	// Get gender breakdown
-	rows, err := db.Query(ctx, `SELECT gender, COUNT(*) FROM horses WHERE farm_id = $1 GROUP BY gender`, farmID)
+	rows, err := db.Query(
+		ctx,
+		`SELECT gender, COUNT(*) FROM horses WHERE farm_id = $1 AND status = ANY($2) GROUP BY gender`,
+		farmID,
+		inventoryStatuses(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gender stats: %w", err)
 	}
@@ -125,14 +358,93 @@ func GetDashboardStats(ctx context.Context, db *database.DB, farmID uuid.UUID) (
 			stats.Mares = count
 		case GenderGelding:
 			stats.Geldings = count
+		case GenderRidgling:
+			stats.Ridglings = count
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
 
+	stats.Stages, err = getStageCounts(ctx, db, farmID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Statuses, err = getStatusCounts(ctx, db, farmID)
+	if err != nil {
+		return nil, err
+	}
 	return stats, nil
 }
 
-type Image struct {
-	Full      string
-	Alt       string
-	Thumbnail string
+// getStatusCounts counts the farm's horses by status, sold and deceased
+// ones included, in the order of Statuses.
+func getStatusCounts(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]StatusCount, error) {
+	rows, err := db.Query(ctx, `SELECT status, COUNT(*) FROM horses WHERE farm_id = $1 GROUP BY status`, farmID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status stats: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[Status]int{}
+	for rows.Next() {
+		var status Status
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan status stats: %w", err)
+		}
+		counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	statuses := make([]StatusCount, len(Statuses))
+	for i, s := range Statuses {
+		statuses[i] = StatusCount{Status: s, Count: counts[s]}
+	}
+	return statuses, nil
+}
+
+// getStageCounts works out the farm's horses' life stages in Go, since the
+// farm's rules decide them.
+func getStageCounts(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]StageCount, error) {
+	rules, err := farm.GetLifeStageRules(ctx, db, farmID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT date_of_birth, birth_date_precision FROM horses WHERE farm_id = $1 AND status = ANY($2)`,
+		farmID,
+		inventoryStatuses(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get birth dates: %w", err)
+	}
+	defer rows.Close()
+	var births []lifestage.BirthDate
+	for rows.Next() {
+		var dob *time.Time
+		var precision lifestage.Precision
+		if err := rows.Scan(&dob, &precision); err != nil {
+			return nil, fmt.Errorf("failed to scan birth date: %w", err)
+		}
+		births = append(births, birthDate(dob, precision))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	now := time.Now()
+	counts := map[lifestage.Stage]int{}
+	for _, birth := range births {
+		counts[rules.StageAt(birth, now)]++
+	}
+	var stages []StageCount
+	for _, stage := range rules.Stages() {
+		if counts[stage] > 0 {
+			stages = append(stages, StageCount{Stage: stage, Count: counts[stage]})
+		}
+	}
+	return stages, nil
 }
@@ -0,0 +1,208 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/mail"
+	"github.com/DevonFarm/sales/storage"
+	"github.com/DevonFarm/sales/user"
+)
+
+const (
+	AddedNoticeJob  = "horse.added_notice"
+	DeleteBlobsJob  = "horse.delete_blobs"
+	ProcessImageJob = "horse.process_image"
+	// RegenerateVariantsJob re-renders a farm's photos after its watermark
+	// changes
+	RegenerateVariantsJob = "horse.regenerate_variants"
+	ComputeCOIJob         = "horse.compute_coi"
+)
+
+type addedNotice struct {
+	HorseID uuid.UUID `json:"horse_id"`
+	AddedBy uuid.UUID `json:"added_by"`
+}
+
+type deleteBlobs struct {
+	Keys []string `json:"keys"`
+}
+
+type processImage struct {
+	ImageID uuid.UUID `json:"image_id"`
+}
+
+type computeCOI struct {
+	// RootID is the horse or external ancestor whose parents changed
+	RootID uuid.UUID `json:"root_id"`
+}
+
+type regenerateVariants struct {
+	FarmID uuid.UUID `json:"farm_id"`
+}
+
+// RegisterJobs registers the handlers for the horse package's jobs.
+func RegisterJobs(q *jobs.Queue, db *database.DB, mailer *mail.Mailer, store storage.Store) {
+	q.Handle(AddedNoticeJob, sendAddedNotice(db, mailer))
+	q.Handle(DeleteBlobsJob, runDeleteBlobs(store))
+	q.Handle(ProcessImageJob, runProcessImage(db, store))
+	q.Handle(RegenerateVariantsJob, runRegenerateVariants(db, store))
+	q.Handle(ComputeCOIJob, runComputeCOI(db))
+}
+
+// EnqueueComputeCOI queues recomputing the coefficients of inbreeding that
+// depend on the pedigree of the horse or external ancestor id.
+func EnqueueComputeCOI(ctx context.Context, db jobs.Execer, id uuid.UUID) error {
+	return jobs.Enqueue(
+		ctx,
+		db,
+		ComputeCOIJob,
+		"compute-coi:"+id.String()+":"+uuid.NewString(),
+		computeCOI{RootID: id},
+	)
+}
+
+func runComputeCOI(db *database.DB) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p computeCOI
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		return ComputeCOI(ctx, db, p.RootID)
+	}
+}
+
+func enqueueProcessImage(ctx context.Context, tx jobs.Execer, img *Image) error {
+	return jobs.Enqueue(ctx, tx, ProcessImageJob, "process-image:"+img.ID.String(), processImage{ImageID: img.ID})
+}
+
+func runProcessImage(db *database.DB, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p processImage
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		img, err := GetImage(ctx, db, p.ImageID)
+		if err != nil {
+			return err
+		}
+		if img == nil || img.IsProcessed() {
+			return nil
+		}
+		return ProcessImage(ctx, db, store, img)
+	}
+}
+
+// EnqueueRegenerateVariants queues re-rendering all of the farm's photos.
+// Every call queues a new job, since each follows a different change.
+func EnqueueRegenerateVariants(ctx context.Context, db jobs.Execer, farmID uuid.UUID) error {
+	return jobs.Enqueue(
+		ctx,
+		db,
+		RegenerateVariantsJob,
+		"regenerate-variants:"+farmID.String()+":"+uuid.NewString(),
+		regenerateVariants{FarmID: farmID},
+	)
+}
+
+func runRegenerateVariants(db *database.DB, store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p regenerateVariants
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		return RegenerateVariants(ctx, db, store, p.FarmID)
+	}
+}
+
+// EnqueueFarmBlobDeletion queues removal of the files of all the farm's
+// horses. Call it in the transaction that deletes the farm, before the
+// horse rows cascade away.
+func EnqueueFarmBlobDeletion(ctx context.Context, tx database.Querier, farmID uuid.UUID) error {
+	keys, err := GetFarmBlobKeys(ctx, tx, farmID)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return jobs.Enqueue(ctx, tx, DeleteBlobsJob, "delete-farm-blobs:"+farmID.String(), deleteBlobs{Keys: keys})
+}
+
+func runDeleteBlobs(store storage.Store) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p deleteBlobs
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		// Deleting a missing blob succeeds, so a retry can start over
+		var errs []error
+		for _, key := range p.Keys {
+			if err := store.Delete(ctx, key); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// EnqueueAddedNotice queues an email to the other members of the horse's
+// farm letting them know it was added.
+func EnqueueAddedNotice(ctx context.Context, db jobs.Execer, h *Horse, addedBy *user.User) error {
+	return jobs.Enqueue(
+		ctx,
+		db,
+		AddedNoticeJob,
+		"horse-added:"+h.ID.String(),
+		addedNotice{HorseID: h.ID, AddedBy: addedBy.ID},
+	)
+}
+
+func sendAddedNotice(db *database.DB, mailer *mail.Mailer) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p addedNotice
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		h, err := GetHorse(ctx, db, p.HorseID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Removed again before anyone was told
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		members, err := user.GetUsersByFarmID(ctx, db, h.FarmID)
+		if err != nil {
+			return err
+		}
+		var addedBy string
+		for _, m := range members {
+			if m.ID == p.AddedBy {
+				addedBy = m.Name
+			}
+		}
+		if addedBy == "" {
+			addedBy = "Someone"
+		}
+
+		subject := fmt.Sprintf("%s was added to your farm", h.Name)
+		body := fmt.Sprintf("%s added %s to your farm on Devon Farm Sales.\n", addedBy, h.Name)
+		// A retry sends to everyone again; a duplicate beats a missing notice
+		for _, m := range members {
+			if m.ID == p.AddedBy {
+				continue
+			}
+			if err := mailer.Send(ctx, m.Email, subject, body); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,732 @@
+package horse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/farm"
+	"github.com/DevonFarm/sales/metrics"
+	"github.com/DevonFarm/sales/photo"
+	"github.com/DevonFarm/sales/storage"
+)
+
+const (
+	// imageURLTTL is how long the image links on a rendered page work
+	imageURLTTL = time.Hour
+	// documentURLTTL is short since a document link is followed at once
+	documentURLTTL = 5 * time.Minute
+)
+
+// Upload types we accept, by sniffed content type, with the extension
+// they are stored under
+var (
+	imageTypes = map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
+		"image/webp": ".webp",
+		"image/gif":  ".gif",
+	}
+	documentTypes = map[string]string{
+		"application/pdf": ".pdf",
+		"image/jpeg":      ".jpg",
+		"image/png":       ".png",
+	}
+)
+
+// ErrUnsupportedType is returned for uploads whose content is not one of
+// the accepted types, whatever their file name claims.
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+type Image struct {
+	ID      uuid.UUID `db:"id"`
+	HorseID uuid.UUID `db:"horse_id"`
+	// Key is the raw upload until the image is processed, then the clean
+	// full size original
+	Key           string     `db:"storage_key"`
+	ContentType   string     `db:"content_type"`
+	Alt           string     `db:"alt"`
+	Position      int        `db:"position"`
+	Width         int        `db:"width"`
+	Height        int        `db:"height"`
+	VariantWidths []int32    `db:"variant_widths"`
+	ProcessedAt   *time.Time `db:"processed_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	// The URLs below are signed and set by ResolveImageURLs. Full and
+	// Thumbnail are the largest and smallest JPEG variants.
+	Full      string `db:"-"`
+	Thumbnail string `db:"-"`
+	// Original links to the clean, unwatermarked upload, for staff only
+	Original   string `db:"-"`
+	SrcsetJPEG string `db:"-"`
+	SrcsetWebP string `db:"-"`
+}
+
+// imageColumns lists the columns scanned into an Image by name
+const imageColumns = `id, horse_id, storage_key, content_type, alt, position, width, height, variant_widths, processed_at, created_at`
+
+func (img *Image) IsProcessed() bool {
+	return img.ProcessedAt != nil
+}
+
+// dir is the prefix all of the image's blobs are stored under.
+func (img *Image) dir() string {
+	return fmt.Sprintf("horses/%s/images/%s", img.HorseID, img.ID)
+}
+
+func (img *Image) variantKey(width int, ext string) string {
+	return fmt.Sprintf("%s/%d%s", img.dir(), width, ext)
+}
+
+// blobKeys lists every blob stored for the image.
+func (img *Image) blobKeys() []string {
+	keys := []string{img.Key}
+	for _, w := range img.VariantWidths {
+		keys = append(keys, img.variantKey(int(w), ".jpg"), img.variantKey(int(w), ".webp"))
+	}
+	return keys
+}
+
+type Document struct {
+	ID          uuid.UUID `db:"id"`
+	HorseID     uuid.UUID `db:"horse_id"`
+	Key         string    `db:"storage_key"`
+	Filename    string    `db:"filename"`
+	ContentType string    `db:"content_type"`
+	Size        int64     `db:"size"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// upload is an uploaded file whose type has been checked by sniffing.
+type upload struct {
+	r           io.Reader
+	size        int64
+	contentType string
+	ext         string
+}
+
+// openUpload opens fh and checks its content against allowed. The caller
+// must close the returned file.
+func openUpload(fh *multipart.FileHeader, allowed map[string]string) (multipart.File, *upload, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	br := bufio.NewReaderSize(f, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	contentType := http.DetectContentType(head)
+	ext, ok := allowed[contentType]
+	if !ok {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	return f, &upload{r: br, size: fh.Size, contentType: contentType, ext: ext}, nil
+}
+
+// AddImage stores an uploaded photo of h and appends it to h's gallery. The
+// upload is kept privately and only shown once a background job has
+// processed it into resized variants.
+func AddImage(ctx context.Context, db *database.DB, store storage.Store, h *Horse, fh *multipart.FileHeader, alt string) (*Image, error) {
+	defer metrics.TimeQuery("horse.AddImage")()
+
+	f, up, err := openUpload(fh, imageTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img := &Image{
+		ID:          uuid.New(),
+		HorseID:     h.ID,
+		ContentType: up.contentType,
+		Alt:         alt,
+	}
+	img.Key = img.dir() + "/upload" + up.ext
+	if err := store.Put(ctx, img.Key, up.r, up.size, up.contentType); err != nil {
+		return nil, err
+	}
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		row := tx.QueryRow(
+			ctx,
+			`INSERT INTO horse_images (id, horse_id, storage_key, content_type, alt, position)
+			VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(position), -1) + 1 FROM horse_images WHERE horse_id = $2))
+			RETURNING position, created_at`,
+			img.ID,          // $1
+			img.HorseID,     // $2
+			img.Key,         // $3
+			img.ContentType, // $4
+			img.Alt,         // $5
+		)
+		if err := row.Scan(&img.Position, &img.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert horse image: %w", err)
+		}
+		return enqueueProcessImage(ctx, tx, img)
+	})
+	if err != nil {
+		deleteBlob(ctx, store, img.Key)
+		return nil, err
+	}
+	return img, nil
+}
+
+// GetImage returns the image with the given ID, or nil if there is none.
+func GetImage(ctx context.Context, db *database.DB, imageID uuid.UUID) (*Image, error) {
+	defer metrics.TimeQuery("horse.GetImage")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+imageColumns+` FROM horse_images WHERE id = $1`,
+		imageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query horse image: %w", err)
+	}
+	img, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Image])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get horse image: %w", err)
+	}
+	return img, nil
+}
+
+func GetImages(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*Image, error) {
+	defer metrics.TimeQuery("horse.GetImages")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+imageColumns+` FROM horse_images WHERE horse_id = $1 ORDER BY position`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query horse images: %w", err)
+	}
+	images, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Image])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect horse images: %w", err)
+	}
+	return images, nil
+}
+
+// GetCoverImages returns the first processed image of each of the given
+// horses that has one, by horse ID.
+func GetCoverImages(ctx context.Context, db *database.DB, horseIDs []uuid.UUID) (map[uuid.UUID]*Image, error) {
+	defer metrics.TimeQuery("horse.GetCoverImages")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT DISTINCT ON (horse_id) `+imageColumns+`
+		FROM horse_images
+		WHERE horse_id = ANY($1) AND processed_at IS NOT NULL
+		ORDER BY horse_id, position`,
+		horseIDs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cover images: %w", err)
+	}
+	images, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Image])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect cover images: %w", err)
+	}
+	covers := make(map[uuid.UUID]*Image, len(images))
+	for _, img := range images {
+		covers[img.HorseID] = img
+	}
+	return covers, nil
+}
+
+// LoadCovers sets the cover of each of the horses that has a processed
+// image, with its URLs signed.
+func LoadCovers(ctx context.Context, db *database.DB, store storage.Store, horses []*Horse) error {
+	ids := make([]uuid.UUID, len(horses))
+	for i, h := range horses {
+		ids[i] = h.ID
+	}
+	covers, err := GetCoverImages(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	images := make([]*Image, 0, len(covers))
+	for _, h := range horses {
+		if img, ok := covers[h.ID]; ok {
+			h.Cover = img
+			images = append(images, img)
+		}
+	}
+	return ResolveImageURLs(ctx, store, images)
+}
+
+// DeleteImage removes one of the horse's images. It reports false if the
+// horse has no such image.
+func DeleteImage(ctx context.Context, db *database.DB, store storage.Store, horseID, imageID uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("horse.DeleteImage")()
+
+	rows, err := db.Query(
+		ctx,
+		`DELETE FROM horse_images WHERE id = $1 AND horse_id = $2 RETURNING `+imageColumns,
+		imageID,
+		horseID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete horse image: %w", err)
+	}
+	img, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Image])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete horse image: %w", err)
+	}
+	for _, key := range img.blobKeys() {
+		deleteBlob(ctx, store, key)
+	}
+	return true, nil
+}
+
+// ProcessImage turns the raw upload of img into a clean full size original
+// and resized JPEG and WebP variants, then drops the upload. Decoding
+// rotates the photo upright and nothing of its EXIF data, GPS position
+// included, is carried over. The variants carry the farm's watermark if it
+// has one. An upload that cannot be decoded will never succeed, so the
+// image is removed rather than left processing.
+func ProcessImage(ctx context.Context, db *database.DB, store storage.Store, img *Image) error {
+	defer metrics.TimeQuery("horse.ProcessImage")()
+
+	src, err := readImage(ctx, store, img.Key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, errUndecodable) {
+		slog.Warn("cannot process horse image, removing it", "image_id", img.ID, "error", err)
+		_, err := DeleteImage(ctx, db, store, img.HorseID, img.ID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	h, err := GetHorse(ctx, db, img.HorseID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The horse and its images went while the job waited
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	st, err := loadStamp(ctx, db, store, h.FarmID)
+	if err != nil {
+		return err
+	}
+
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	original := img.dir() + "/original.jpg"
+	if err := putEncoded(ctx, store, original, "image/jpeg", src, photo.EncodeOriginal); err != nil {
+		return err
+	}
+	widths, err := renderVariants(ctx, store, img, src, st)
+	if err != nil {
+		return err
+	}
+
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE horse_images
+		SET storage_key = $2, content_type = 'image/jpeg', width = $3, height = $4, variant_widths = $5, processed_at = now()
+		WHERE id = $1 AND processed_at IS NULL`,
+		img.ID,   // $1
+		original, // $2
+		width,    // $3
+		height,   // $4
+		widths,   // $5
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update horse image: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		current, err := GetImage(ctx, db, img.ID)
+		if err != nil || current != nil {
+			// Processed by another run, which wrote the same keys
+			return err
+		}
+		// Deleted while we worked; DeleteImage only knew of the upload
+		img.Key = original
+		img.VariantWidths = widths
+		for _, key := range img.blobKeys() {
+			deleteBlob(ctx, store, key)
+		}
+		return nil
+	}
+	deleteBlob(ctx, store, img.Key)
+	return nil
+}
+
+// RegenerateVariants renders the variants of every processed image of the
+// farm again from their clean originals, so that a change of watermark
+// reaches photos uploaded before it.
+func RegenerateVariants(ctx context.Context, db *database.DB, store storage.Store, farmID uuid.UUID) error {
+	defer metrics.TimeQuery("horse.RegenerateVariants")()
+
+	images, err := getFarmImages(ctx, db, farmID)
+	if err != nil {
+		return err
+	}
+	st, err := loadStamp(ctx, db, store, farmID)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if !img.IsProcessed() {
+			// Its processing job will pick up the current watermark
+			continue
+		}
+		src, err := readImage(ctx, store, img.Key)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, errUndecodable) {
+			slog.Warn("cannot regenerate horse image variants", "image_id", img.ID, "error", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		widths, err := renderVariants(ctx, store, img, src, st)
+		if err != nil {
+			return err
+		}
+		tag, err := db.Exec(
+			ctx,
+			`UPDATE horse_images SET variant_widths = $2 WHERE id = $1`,
+			img.ID,
+			widths,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update horse image: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			img.VariantWidths = widths
+			for _, key := range img.blobKeys() {
+				deleteBlob(ctx, store, key)
+			}
+		}
+	}
+	return nil
+}
+
+// errUndecodable marks a blob that is not an image we can read, which no
+// retry will fix.
+var errUndecodable = errors.New("undecodable image")
+
+func readImage(ctx context.Context, store storage.Store, key string) (image.Image, error) {
+	obj, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	b, err := io.ReadAll(obj.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	img, err := photo.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUndecodable, err)
+	}
+	return img, nil
+}
+
+// stamp is a farm's watermark loaded and ready to draw.
+type stamp struct {
+	logo     image.Image
+	position photo.Position
+	opacity  float64
+}
+
+// loadStamp returns the farm's watermark, or nil if its photos are not
+// watermarked.
+func loadStamp(ctx context.Context, db *database.DB, store storage.Store, farmID uuid.UUID) (*stamp, error) {
+	w, err := farm.GetWatermark(ctx, db, farmID)
+	if err != nil {
+		return nil, err
+	}
+	if !w.Active() {
+		return nil, nil
+	}
+	logo, err := readImage(ctx, store, w.LogoKey)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, errUndecodable) {
+		slog.Warn("farm watermark logo unusable, leaving photos unmarked", "farm_id", farmID, "error", err)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stamp{logo: logo, position: w.Position, opacity: w.Opacity}, nil
+}
+
+// renderVariants stores the resized copies of src, watermarked with st
+// when it is not nil, and returns their widths.
+func renderVariants(ctx context.Context, store storage.Store, img *Image, src image.Image, st *stamp) ([]int32, error) {
+	var widths []int32
+	for _, w := range photo.VariantWidths(src.Bounds().Dx()) {
+		variant := photo.Resize(src, w)
+		if st != nil {
+			variant = photo.Watermark(variant, st.logo, st.position, st.opacity)
+		}
+		if err := putEncoded(ctx, store, img.variantKey(w, ".jpg"), "image/jpeg", variant, photo.EncodeJPEG); err != nil {
+			return nil, err
+		}
+		if err := putEncoded(ctx, store, img.variantKey(w, ".webp"), "image/webp", variant, photo.EncodeWebP); err != nil {
+			return nil, err
+		}
+		widths = append(widths, int32(w))
+	}
+	return widths, nil
+}
+
+func putEncoded(ctx context.Context, store storage.Store, key, contentType string, img image.Image, encode func(image.Image) ([]byte, error)) error {
+	b, err := encode(img)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(b), int64(len(b)), contentType)
+}
+
+// ResolveImageURLs fills in the signed URLs of the processed images.
+func ResolveImageURLs(ctx context.Context, store storage.Store, images []*Image) error {
+	for _, img := range images {
+		if !img.IsProcessed() {
+			continue
+		}
+		original, err := store.SignedURL(ctx, img.Key, imageURLTTL, "")
+		if err != nil {
+			return err
+		}
+		img.Original = original
+		var jpegs, webps []string
+		for i, w := range img.VariantWidths {
+			jpegURL, err := store.SignedURL(ctx, img.variantKey(int(w), ".jpg"), imageURLTTL, "")
+			if err != nil {
+				return err
+			}
+			webpURL, err := store.SignedURL(ctx, img.variantKey(int(w), ".webp"), imageURLTTL, "")
+			if err != nil {
+				return err
+			}
+			jpegs = append(jpegs, fmt.Sprintf("%s %dw", jpegURL, w))
+			webps = append(webps, fmt.Sprintf("%s %dw", webpURL, w))
+			if i == 0 {
+				img.Thumbnail = jpegURL
+			}
+			img.Full = jpegURL
+		}
+		img.SrcsetJPEG = strings.Join(jpegs, ", ")
+		img.SrcsetWebP = strings.Join(webps, ", ")
+	}
+	return nil
+}
+
+// AddDocument stores an uploaded document, such as a passport scan or vet
+// certificate, against h.
+func AddDocument(ctx context.Context, db *database.DB, store storage.Store, h *Horse, fh *multipart.FileHeader) (*Document, error) {
+	defer metrics.TimeQuery("horse.AddDocument")()
+
+	f, up, err := openUpload(fh, documentTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	doc := &Document{
+		ID:          uuid.New(),
+		HorseID:     h.ID,
+		Filename:    documentFilename(fh.Filename, up.ext),
+		ContentType: up.contentType,
+		Size:        up.size,
+	}
+	doc.Key = fmt.Sprintf("horses/%s/documents/%s%s", h.ID, doc.ID, up.ext)
+	if err := store.Put(ctx, doc.Key, up.r, up.size, up.contentType); err != nil {
+		return nil, err
+	}
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO horse_documents (id, horse_id, storage_key, filename, content_type, size)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		doc.ID,          // $1
+		doc.HorseID,     // $2
+		doc.Key,         // $3
+		doc.Filename,    // $4
+		doc.ContentType, // $5
+		doc.Size,        // $6
+	)
+	if err := row.Scan(&doc.CreatedAt); err != nil {
+		deleteBlob(ctx, store, doc.Key)
+		return nil, fmt.Errorf("failed to insert horse document: %w", err)
+	}
+	return doc, nil
+}
+
+func GetDocuments(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*Document, error) {
+	defer metrics.TimeQuery("horse.GetDocuments")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, horse_id, storage_key, filename, content_type, size, created_at
+		FROM horse_documents WHERE horse_id = $1 ORDER BY created_at`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query horse documents: %w", err)
+	}
+	docs, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Document])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect horse documents: %w", err)
+	}
+	return docs, nil
+}
+
+// GetDocument returns one of the horse's documents, or nil if it has no
+// such document.
+func GetDocument(ctx context.Context, db *database.DB, horseID, docID uuid.UUID) (*Document, error) {
+	defer metrics.TimeQuery("horse.GetDocument")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, horse_id, storage_key, filename, content_type, size, created_at
+		FROM horse_documents WHERE id = $1 AND horse_id = $2`,
+		docID,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query horse document: %w", err)
+	}
+	doc, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Document])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get horse document: %w", err)
+	}
+	return doc, nil
+}
+
+// DownloadURL returns a short lived link that downloads the document under
+// its original name.
+func (d *Document) DownloadURL(ctx context.Context, store storage.Store) (string, error) {
+	return store.SignedURL(ctx, d.Key, documentURLTTL, d.Filename)
+}
+
+// DeleteDocument removes one of the horse's documents. It reports false if
+// the horse has no such document.
+func DeleteDocument(ctx context.Context, db *database.DB, store storage.Store, horseID, docID uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("horse.DeleteDocument")()
+
+	var key string
+	row := db.QueryRow(
+		ctx,
+		`DELETE FROM horse_documents WHERE id = $1 AND horse_id = $2 RETURNING storage_key`,
+		docID,
+		horseID,
+	)
+	if err := row.Scan(&key); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete horse document: %w", err)
+	}
+	deleteBlob(ctx, store, key)
+	return true, nil
+}
+
+// GetFarmBlobKeys lists the storage keys of every file belonging to the
+// farm and its horses, so they can be removed along with the farm.
+func GetFarmBlobKeys(ctx context.Context, db database.Querier, farmID uuid.UUID) ([]string, error) {
+	defer metrics.TimeQuery("horse.GetFarmBlobKeys")()
+
+	images, err := getFarmImages(ctx, db, farmID)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, img := range images {
+		keys = append(keys, img.blobKeys()...)
+	}
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT d.storage_key FROM horse_documents d JOIN horses h ON h.id = d.horse_id WHERE h.farm_id = $1
+		UNION ALL
+		SELECT watermark_logo_key FROM farms WHERE id = $1 AND watermark_logo_key != ''`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query farm files: %w", err)
+	}
+	otherKeys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect farm files: %w", err)
+	}
+	return append(keys, otherKeys...), nil
+}
+
+func getFarmImages(ctx context.Context, db database.Querier, farmID uuid.UUID) ([]*Image, error) {
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+prefixColumns("i", imageColumns)+`
+		FROM horse_images i JOIN horses h ON h.id = i.horse_id WHERE h.farm_id = $1`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query farm images: %w", err)
+	}
+	images, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Image])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect farm images: %w", err)
+	}
+	return images, nil
+}
+
+// prefixColumns qualifies each of a comma separated list of columns with
+// a table alias.
+func prefixColumns(alias, columns string) string {
+	cols := strings.Split(columns, ", ")
+	for i, col := range cols {
+		cols[i] = alias + "." + col
+	}
+	return strings.Join(cols, ", ")
+}
+
+// deleteBlob removes a blob whose row is already gone. A failure only
+// leaves an unreferenced file behind, so it is logged rather than returned.
+func deleteBlob(ctx context.Context, store storage.Store, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		slog.ErrorContext(ctx, "failed to delete blob", "key", key, "error", err)
+	}
+}
+
+// documentFilename makes an uploaded file name safe to offer back as a
+// download name, forcing the extension to match the sniffed type.
+func documentFilename(name, ext string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`"/\;`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." {
+		name = "document"
+	}
+	return name + ext
+}
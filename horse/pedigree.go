@@ -0,0 +1,466 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/coatcolor"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+const (
+	// DefaultGenerations is how many generations of ancestors the pedigree
+	// chart shows, up to the horse's great-great-grandparents
+	DefaultGenerations = 4
+	MaxGenerations     = 5
+)
+
+// Ancestor is a horse as it appears in a pedigree: one of the farm's
+// horses, or an external ancestor recorded only for pedigrees.
+type Ancestor struct {
+	ID                 uuid.UUID `db:"id"`
+	FarmID             uuid.UUID `db:"farm_id"`
+	Name               string    `db:"name"`
+	RegistrationNumber string    `db:"registration_number"`
+	Gender             Gender    `db:"gender"`
+	// BirthYear is 0 when unknown
+	BirthYear int       `db:"birth_year"`
+	SireID    uuid.UUID `db:"sire_id"`
+	DamID     uuid.UUID `db:"dam_id"`
+	External  bool      `db:"external"`
+	// Genotype is the coat color genotype, by locus
+	Genotype coatcolor.Genotype `db:"color_genotype"`
+}
+
+// pedigreeNodes puts horses and external ancestors into one relation, so
+// that a line of ancestors can cross freely between the two.
+const pedigreeNodes = `(
+	SELECT id, farm_id, name, '' AS registration_number, gender,
+		COALESCE(extract(year FROM date_of_birth)::INT, 0) AS birth_year, sire_id, dam_id, false AS external, color_genotype
+	FROM horses
+	UNION ALL
+	SELECT id, farm_id, name, registration_number, gender, birth_year, sire_id, dam_id, true AS external, color_genotype
+	FROM external_ancestors
+)`
+
+const ancestorColumns = `id, farm_id, name, registration_number, gender, birth_year, sire_id, dam_id, external, color_genotype`
+
+// CanSire reports whether the ancestor can be entered as a sire. Geldings
+// count, since they may have sired foals before being gelded.
+func (a *Ancestor) CanSire() bool {
+	return a.Gender.IsEntire() || a.Gender == GenderGelding
+}
+
+func (a *Ancestor) CanDam() bool {
+	return a.Gender == GenderMare
+}
+
+// Path links to the ancestor's horse page, or is empty for an external
+// ancestor, which has none.
+func (a *Ancestor) Path() string {
+	if a.External {
+		return ""
+	}
+	return fmt.Sprintf("/farm/%s/horse/%s", a.FarmID, a.ID)
+}
+
+func scanAncestors(rows pgx.Rows) ([]*Ancestor, error) {
+	ancestors, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Ancestor])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect ancestors: %w", err)
+	}
+	return ancestors, nil
+}
+
+// GetAncestor returns the horse or external ancestor with the given ID, or
+// nil if there is neither.
+func GetAncestor(ctx context.Context, db *database.DB, id uuid.UUID) (*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetAncestor")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n WHERE id = $1`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ancestor: %w", err)
+	}
+	a, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Ancestor])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ancestor: %w", err)
+	}
+	return a, nil
+}
+
+// GetFarmAncestors returns the farm's horses and external ancestors, which
+// are the choices when entering a parent.
+func GetFarmAncestors(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetFarmAncestors")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n WHERE farm_id = $1 ORDER BY name`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query farm ancestors: %w", err)
+	}
+	return scanAncestors(rows)
+}
+
+// GetExternalAncestors returns only the farm's external ancestors.
+func GetExternalAncestors(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetExternalAncestors")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		WHERE farm_id = $1 AND external ORDER BY name`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query external ancestors: %w", err)
+	}
+	return scanAncestors(rows)
+}
+
+// GetBreedingCandidates returns the farm's external ancestors and those of
+// its horses still in its inventory, the choices when planning a pairing.
+func GetBreedingCandidates(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetBreedingCandidates")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		WHERE farm_id = $1
+			AND (external OR id IN (SELECT id FROM horses WHERE farm_id = $1 AND status = ANY($2)))
+		ORDER BY name`,
+		farmID,              // $1
+		inventoryStatuses(), // $2
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query breeding candidates: %w", err)
+	}
+	return scanAncestors(rows)
+}
+
+// GetAncestors returns the ancestors of the horse with the given ID, going
+// back the given number of generations, by ID. The horse itself is
+// included.
+func GetAncestors(ctx context.Context, db *database.DB, id uuid.UUID, generations int) (map[uuid.UUID]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetAncestors")()
+
+	rows, err := db.Query(
+		ctx,
+		`WITH RECURSIVE nodes AS (
+			SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		), tree AS (
+			SELECT nodes.*, 0 AS depth FROM nodes WHERE id = $1
+			UNION ALL
+			SELECT nodes.*, tree.depth + 1
+			FROM tree JOIN nodes ON nodes.id = tree.sire_id OR nodes.id = tree.dam_id
+			WHERE tree.depth < $2
+		)
+		SELECT `+ancestorColumns+` FROM tree`,
+		id,          // $1
+		generations, // $2
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ancestors: %w", err)
+	}
+	ancestors, err := scanAncestors(rows)
+	if err != nil {
+		return nil, err
+	}
+	// An ancestor recurring in the pedigree comes back once per path
+	byID := make(map[uuid.UUID]*Ancestor, len(ancestors))
+	for _, a := range ancestors {
+		byID[a.ID] = a
+	}
+	return byID, nil
+}
+
+// GetOffspring returns the horses and external ancestors that the horse
+// with the given ID sired or foaled.
+func GetOffspring(ctx context.Context, db *database.DB, id uuid.UUID) ([]*Ancestor, error) {
+	defer metrics.TimeQuery("horse.GetOffspring")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		WHERE sire_id = $1 OR dam_id = $1 ORDER BY birth_year, name`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offspring: %w", err)
+	}
+	return scanAncestors(rows)
+}
+
+// Siblings are the horses sharing both parents, or only one, with a horse.
+type Siblings struct {
+	Full []*Ancestor
+	Half []*Ancestor
+}
+
+func GetSiblings(ctx context.Context, db *database.DB, a *Ancestor) (*Siblings, error) {
+	defer metrics.TimeQuery("horse.GetSiblings")()
+
+	s := &Siblings{}
+	if a.SireID == uuid.Nil && a.DamID == uuid.Nil {
+		return s, nil
+	}
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+ancestorColumns+` FROM `+pedigreeNodes+` AS n
+		WHERE id != $1 AND ((sire_id = $2 AND $2 != $4) OR (dam_id = $3 AND $3 != $4))
+		ORDER BY birth_year, name`,
+		a.ID,     // $1
+		a.SireID, // $2
+		a.DamID,  // $3
+		uuid.Nil, // $4
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query siblings: %w", err)
+	}
+	siblings, err := scanAncestors(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, sib := range siblings {
+		full := a.SireID != uuid.Nil && a.DamID != uuid.Nil
+		if full && sib.SireID == a.SireID && sib.DamID == a.DamID {
+			s.Full = append(s.Full, sib)
+		} else {
+			s.Half = append(s.Half, sib)
+		}
+	}
+	return s, nil
+}
+
+// PedigreeCell is one ancestor's box in a pedigree chart. Ancestor is nil
+// when that ancestor is unknown.
+type PedigreeCell struct {
+	Ancestor *Ancestor
+	// Role is "Sire" or "Dam"
+	Role    string
+	Rowspan int
+}
+
+// Pedigree lays a horse's ancestry out as the rows of a table: the first
+// column holds the sire and dam, the next the four grandparents, and so on,
+// with each ancestor spanning the rows of its own parents.
+type Pedigree struct {
+	Generations int
+	Rows        [][]PedigreeCell
+}
+
+// BuildPedigree charts root's ancestry from ancestors, as returned by
+// GetAncestors.
+func BuildPedigree(root uuid.UUID, ancestors map[uuid.UUID]*Ancestor, generations int) *Pedigree {
+	// Each generation doubles, so ancestor i of generation g is reached by
+	// reading i's g bits from the top, 0 for the sire and 1 for the dam
+	find := func(g, i int) *Ancestor {
+		a := ancestors[root]
+		for bit := g - 1; bit >= 0 && a != nil; bit-- {
+			parent := a.SireID
+			if i>>bit&1 == 1 {
+				parent = a.DamID
+			}
+			a = ancestors[parent]
+		}
+		return a
+	}
+
+	total := 1 << generations
+	p := &Pedigree{Generations: generations, Rows: make([][]PedigreeCell, total)}
+	for r := range total {
+		for g := 1; g <= generations; g++ {
+			span := total >> g
+			if r%span != 0 {
+				continue
+			}
+			i := r / span
+			role := "Sire"
+			if i%2 == 1 {
+				role = "Dam"
+			}
+			p.Rows[r] = append(p.Rows[r], PedigreeCell{Ancestor: find(g, i), Role: role, Rowspan: span})
+		}
+	}
+	return p
+}
+
+// ErrInvalidParent is returned when a sire or dam cannot be entered, such
+// as a mare as sire or a horse as its own ancestor.
+var ErrInvalidParent = errors.New("invalid parent")
+
+// SetParents records the sire and dam, either of which may be uuid.Nil for
+// unknown, of the horse or external ancestor child.
+func SetParents(ctx context.Context, db *database.DB, child *Ancestor, sireID, damID uuid.UUID) error {
+	defer metrics.TimeQuery("horse.SetParents")()
+
+	if err := checkParent(ctx, db, child, sireID, (*Ancestor).CanSire, "sire"); err != nil {
+		return err
+	}
+	if err := checkParent(ctx, db, child, damID, (*Ancestor).CanDam, "dam"); err != nil {
+		return err
+	}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE `+child.table()+` SET sire_id = NULLIF($2, $4), dam_id = NULLIF($3, $4) WHERE id = $1`,
+			child.ID, // $1
+			sireID,   // $2
+			damID,    // $3
+			uuid.Nil, // $4
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set parents: %w", err)
+		}
+		// The child's coefficient, and those of all its descendants, may
+		// have changed
+		return EnqueueComputeCOI(ctx, tx, child.ID)
+	})
+	if err != nil {
+		return err
+	}
+	child.SireID, child.DamID = sireID, damID
+	return nil
+}
+
+func checkParent(ctx context.Context, db *database.DB, child *Ancestor, parentID uuid.UUID, fits func(*Ancestor) bool, role string) error {
+	if parentID == uuid.Nil {
+		return nil
+	}
+	if parentID == child.ID {
+		return fmt.Errorf("%w: a horse cannot be its own %s", ErrInvalidParent, role)
+	}
+	parent, err := GetAncestor(ctx, db, parentID)
+	if err != nil {
+		return err
+	}
+	if parent == nil || parent.FarmID != child.FarmID {
+		return fmt.Errorf("%w: unknown %s", ErrInvalidParent, role)
+	}
+	if !fits(parent) {
+		return fmt.Errorf("%w: %s cannot be a %s", ErrInvalidParent, parent.Name, role)
+	}
+	if child.BirthYear != 0 && parent.BirthYear != 0 && parent.BirthYear >= child.BirthYear {
+		return fmt.Errorf("%w: %s was born after %s", ErrInvalidParent, parent.Name, child.Name)
+	}
+	descends, err := isAncestor(ctx, db, child.ID, parentID)
+	if err != nil {
+		return err
+	}
+	if descends {
+		return fmt.Errorf("%w: %s descends from %s", ErrInvalidParent, parent.Name, child.Name)
+	}
+	return nil
+}
+
+// isAncestor reports whether ancestorID appears anywhere in the ancestry
+// of id. UNION rather than UNION ALL visits each ancestor once, however
+// often it recurs, so the walk ends even on inbred lines.
+func isAncestor(ctx context.Context, db *database.DB, ancestorID, id uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("horse.isAncestor")()
+
+	var found bool
+	row := db.QueryRow(
+		ctx,
+		`WITH RECURSIVE nodes AS (
+			SELECT id, sire_id, dam_id FROM `+pedigreeNodes+` AS n
+		), lineage (id) AS (
+			SELECT $2::UUID
+			UNION
+			SELECT parent.id
+			FROM lineage
+			JOIN nodes child ON child.id = lineage.id
+			JOIN nodes parent ON parent.id = child.sire_id OR parent.id = child.dam_id
+		)
+		SELECT EXISTS (SELECT 1 FROM lineage WHERE id = $1)`,
+		ancestorID, // $1
+		id,         // $2
+	)
+	if err := row.Scan(&found); err != nil {
+		return false, fmt.Errorf("failed to check ancestry: %w", err)
+	}
+	return found, nil
+}
+
+// GenotypeField is one locus of a genotype form.
+type GenotypeField struct {
+	Locus coatcolor.Locus
+	// Value is the recorded genotype, empty when untested
+	Value string
+}
+
+func (a *Ancestor) GenotypeFields() []GenotypeField {
+	fields := make([]GenotypeField, len(coatcolor.Loci))
+	for i, l := range coatcolor.Loci {
+		fields[i] = GenotypeField{Locus: l, Value: a.Genotype[l.Symbol]}
+	}
+	return fields
+}
+
+// table is where the ancestor's own row lives.
+func (a *Ancestor) table() string {
+	if a.External {
+		return "external_ancestors"
+	}
+	return "horses"
+}
+
+// SetGenotype records the coat color genotype of the horse or external
+// ancestor a.
+func SetGenotype(ctx context.Context, db *database.DB, a *Ancestor, g coatcolor.Genotype) error {
+	defer metrics.TimeQuery("horse.SetGenotype")()
+
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		ctx,
+		`UPDATE `+a.table()+` SET color_genotype = $2 WHERE id = $1`,
+		a.ID,
+		g,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set genotype: %w", err)
+	}
+	a.Genotype = g
+	return nil
+}
+
+// NewExternalAncestor records a horse the farm never owned so that it can
+// appear in pedigrees.
+func NewExternalAncestor(ctx context.Context, db *database.DB, a *Ancestor) error {
+	defer metrics.TimeQuery("horse.NewExternalAncestor")()
+
+	if a.Gender.IsInvalid() {
+		return fmt.Errorf("invalid horse gender: %d", a.Gender)
+	}
+	row := db.QueryRow(
+		ctx,
+		`INSERT INTO external_ancestors (farm_id, name, registration_number, gender, birth_year)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		a.FarmID,             // $1
+		a.Name,               // $2
+		a.RegistrationNumber, // $3
+		a.Gender,             // $4
+		a.BirthYear,          // $5
+	)
+	if err := row.Scan(&a.ID); err != nil {
+		return fmt.Errorf("failed to insert external ancestor: %w", err)
+	}
+	a.External = true
+	return nil
+}
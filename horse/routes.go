@@ -1,65 +1,349 @@
 package horse
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/audit"
 	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/coatcolor"
 	"github.com/DevonFarm/sales/database"
 	"github.com/DevonFarm/sales/farm"
+	"github.com/DevonFarm/sales/lifestage"
+	"github.com/DevonFarm/sales/logging"
+	"github.com/DevonFarm/sales/photo"
+	"github.com/DevonFarm/sales/storage"
+	"github.com/DevonFarm/sales/user"
 	"github.com/DevonFarm/sales/utils"
 	"github.com/google/uuid"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func RegisterRoutes(app *fiber.App, db *database.DB, auth *auth.StytchAuth) {
-	farmGroup := app.Group("/farm/:farmID", auth.RequireAuth())
-	farmGroup.Get("/", getDashboard(db))
+func RegisterRoutes(app *fiber.App, db *database.DB, auth *auth.StytchAuth, store storage.Store) {
+	farmGroup := app.Group("/farm/:farmID", auth.RequireAuth(), auth.RequireFarmOwner(db))
+	farmGroup.Get("/", getDashboard(db, store))
+	farmGroup.Get("/audit", getAuditLog(db))
+	farmGroup.Get("/watermark", getWatermark(db, store))
+	farmGroup.Post("/watermark", updateWatermark(db, store))
+	farmGroup.Get("/life-stages", getLifeStageRules(db))
+	farmGroup.Post("/life-stages", updateLifeStageRules(db))
 	farmGroup.Get("/horses", getHorses(db))
-	farmGroup.Get("/horse/:id", getHorse(db))
-	farmGroup.Post("/horse", createHorse(db))
+	farmGroup.Get("/horse/:id", getHorse(db, store))
+	farmGroup.Post("/horse", createHorse(db, store))
 	farmGroup.Put("/horse/:id", updateHorse(db))
 	farmGroup.Delete("/horse/:id", deleteHorse(db))
+	farmGroup.Post("/horse/:id/details", setHorseDetails(db))
+	farmGroup.Post("/horse/:id/gender", changeHorseGender(db))
+	farmGroup.Post("/horse/:id/status", changeHorseStatus(db))
+	farmGroup.Post("/horse/:id/parents", setHorseParents(db))
+	farmGroup.Post("/horse/:id/genotype", setHorseGenotype(db))
+	farmGroup.Get("/breeding", getBreedingPlanner(db))
+	farmGroup.Post("/breeding/records", addBreedingRecord(db))
+	farmGroup.Post("/breeding/record/:recordID/delete", deleteBreedingRecord(db))
+	farmGroup.Get("/colors", getColorCalculator(db))
+	farmGroup.Get("/ancestors", getExternalAncestors(db))
+	farmGroup.Post("/ancestors", createExternalAncestor(db))
+	farmGroup.Post("/ancestor/:ancestorID/parents", setAncestorParents(db))
+	farmGroup.Post("/ancestor/:ancestorID/genotype", setAncestorGenotype(db))
+	farmGroup.Post("/horse/:id/images", uploadImages(db, store))
+	farmGroup.Post("/horse/:id/image/:imageID/delete", deleteImage(db, store))
+	farmGroup.Post("/horse/:id/documents", uploadDocument(db, store))
+	farmGroup.Get("/horse/:id/document/:docID", downloadDocument(db, store))
+	farmGroup.Post("/horse/:id/document/:docID/delete", deleteDocument(db, store))
+	farmGroup.Post("/horse/:id/genetic-tests", addGeneticTest(db, store))
+	farmGroup.Post("/horse/:id/genetic-test/:testID/delete", deleteGeneticTest(db))
 
-	app.Get("/list", func(c *fiber.Ctx) error {
-		// TODO: need a different template to list horses
-		return c.Render("templates/create", fiber.Map{
-			"Title": "Listing",
-		})
-	})
+	app.Get("/list", getListings(db, store))
 }
 
-func getDashboard(db *database.DB) func(*fiber.Ctx) error {
+func getDashboard(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		farmID := c.Params("farmID")
 		if farmID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "farm ID is required"})
+			return apperr.Validation("farm ID is required")
 		}
 
 		// Get farm details
-		f, err := farm.GetFarm(c.Context(), db, farmID)
+		f, err := farm.GetFarm(c.UserContext(), db, farmID)
 		if err != nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "farm not found"})
+			return apperr.NotFound("farm not found")
 		}
 
-		horses, err := GetHorsesByFarmID(c.Context(), db, f.ID)
+		filter, err := parseFilter(c)
+		if err != nil {
+			return err
+		}
+		horses, err := GetHorsesByFarmID(c.UserContext(), db, f.ID, filter)
+		if err != nil {
+			return apperr.Internal("failed to get horses", err)
+		}
+		breeds, err := GetBreeds(c.UserContext(), db)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get horses"})
+			return apperr.Internal("failed to get breeds", err)
+		}
+		if err := LoadCovers(c.UserContext(), db, store, horses); err != nil {
+			return apperr.Internal("failed to get cover images", err)
 		}
 
 		// Get dashboard statistics
-		stats, err := GetDashboardStats(c.Context(), db, f.ID)
+		stats, err := GetDashboardStats(c.UserContext(), db, f.ID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get stats"})
+			return apperr.Internal("failed to get stats", err)
 		}
 
 		return c.Render("templates/dashboard", fiber.Map{
-			"Title":  f.Name + " Dashboard",
-			"Farm":   f,
+			"Title":    f.Name + " Dashboard",
+			"Farm":     f,
+			"Horses":   horses,
+			"Stats":    stats,
+			"Breeds":   breeds,
+			"Filter":   filter,
+			"Statuses": Statuses,
+		})
+	}
+}
+
+// getListings shows the public the horses for sale on every farm.
+func getListings(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		filter, err := parseListingFilter(c)
+		if err != nil {
+			return err
+		}
+		horses, err := GetListings(c.UserContext(), db, filter)
+		if err != nil {
+			return apperr.Internal("failed to get listings", err)
+		}
+		breeds, err := GetBreeds(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get breeds", err)
+		}
+		if err := LoadCovers(c.UserContext(), db, store, horses); err != nil {
+			return apperr.Internal("failed to get cover images", err)
+		}
+		if err := LoadPublicGeneticTests(c.UserContext(), db, horses); err != nil {
+			return apperr.Internal("failed to get genetic tests", err)
+		}
+
+		return c.Render("templates/listings", fiber.Map{
+			"Title":  "Horses for Sale",
 			"Horses": horses,
-			"Stats":  stats,
+			"Breeds": breeds,
+			"Filter": filter,
+		})
+	}
+}
+
+// parseFilter reads a horse filter from the query string.
+func parseFilter(c *fiber.Ctx) (Filter, error) {
+	f, err := parseListingFilter(c)
+	if err != nil {
+		return f, err
+	}
+	f.Status = Status(c.Query("status"))
+	if f.Status != "" && f.Status != StatusAll && !f.Status.IsValid() {
+		return f, apperr.Validation("invalid status")
+	}
+	return f, nil
+}
+
+// parseListingFilter reads the filters the public listing offers, which
+// leave out status.
+func parseListingFilter(c *fiber.Ctx) (Filter, error) {
+	var f Filter
+	if s := c.Query("breed"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return f, apperr.Validation("invalid breed ID")
+		}
+		f.BreedID = id
+	}
+	f.Color = strings.TrimSpace(c.Query("color"))
+	f.Sort = Sort(c.Query("sort"))
+	if f.Sort != SortName && f.Sort != SortAge {
+		return f, apperr.Validation("invalid sort")
+	}
+	var err error
+	if f.MinHeight, err = ParseHeight(c.Query("min_height")); err != nil {
+		return f, apperr.Validation(err.Error())
+	}
+	if f.MaxHeight, err = ParseHeight(c.Query("max_height")); err != nil {
+		return f, apperr.Validation(err.Error())
+	}
+	return f, nil
+}
+
+// auditLogLimit caps how many of the most recent events the audit page shows
+const auditLogLimit = 200
+
+func getAuditLog(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+
+		events, err := audit.GetEventsByFarmID(c.UserContext(), db, f.ID, auditLogLimit)
+		if err != nil {
+			return apperr.Internal("failed to get audit events", err)
+		}
+
+		return c.Render("templates/audit", fiber.Map{
+			"Title":  f.Name + " Audit Log",
+			"Farm":   f,
+			"Events": events,
 		})
 	}
 }
 
+// logoURLTTL only needs to cover viewing the watermark settings page
+const logoURLTTL = 10 * time.Minute
+
+func getWatermark(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		w, err := farm.GetWatermark(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get watermark", err)
+		}
+		var logoURL string
+		if w.LogoKey != "" {
+			logoURL, err = store.SignedURL(c.UserContext(), w.LogoKey, logoURLTTL, "")
+			if err != nil {
+				return apperr.Internal("failed to sign logo url", err)
+			}
+		}
+		return c.Render("templates/watermark", fiber.Map{
+			"Title":     f.Name + " Watermark",
+			"Farm":      f,
+			"Watermark": w,
+			"LogoURL":   logoURL,
+			"Positions": photo.Positions,
+		})
+	}
+}
+
+// updateWatermark saves the farm's watermark settings and re-renders its
+// photos to match.
+func updateWatermark(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		w, err := farm.GetWatermark(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get watermark", err)
+		}
+		oldLogo := w.LogoKey
+
+		w.Enabled = c.FormValue("enabled") == "on"
+		w.Position = photo.Position(c.FormValue("position"))
+		if !w.Position.IsValid() {
+			return apperr.Validation("choose where to place the watermark")
+		}
+		opacity, err := strconv.Atoi(c.FormValue("opacity"))
+		if err != nil || opacity < 5 || opacity > 100 {
+			return apperr.Validation("opacity must be between 5 and 100 percent")
+		}
+		w.Opacity = float64(opacity) / 100
+		if fh, err := c.FormFile("logo"); err == nil {
+			w.LogoKey, err = farm.StoreLogo(c.UserContext(), store, f.ID, fh)
+			if errors.Is(err, farm.ErrInvalidLogo) {
+				return apperr.Validation(err.Error())
+			}
+			if err != nil {
+				return apperr.Internal("failed to save logo", err)
+			}
+		}
+		if w.Enabled && w.LogoKey == "" {
+			return apperr.Validation("upload a logo to turn on watermarking")
+		}
+
+		err = pgx.BeginFunc(c.UserContext(), db, func(tx pgx.Tx) error {
+			if err := farm.SaveWatermark(c.UserContext(), tx, f.ID, w); err != nil {
+				return err
+			}
+			return EnqueueRegenerateVariants(c.UserContext(), tx, f.ID)
+		})
+		if err != nil {
+			if w.LogoKey != oldLogo {
+				deleteBlob(c.UserContext(), store, w.LogoKey)
+			}
+			return apperr.Internal("failed to save watermark", err)
+		}
+		if oldLogo != "" && w.LogoKey != oldLogo {
+			deleteBlob(c.UserContext(), store, oldLogo)
+		}
+
+		u := c.Locals("user").(*user.User)
+		audit.Record(c, db, audit.Event{
+			Action: audit.ActionWatermarkUpdated,
+			UserID: u.ID,
+			FarmID: f.ID,
+			Detail: fmt.Sprintf("enabled=%t position=%s opacity=%d%%", w.Enabled, w.Position, opacity),
+		})
+		return c.Redirect(fmt.Sprintf("/farm/%s/watermark", f.ID))
+	}
+}
+
+func getLifeStageRules(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		rules, err := farm.GetLifeStageRules(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get life stage rules", err)
+		}
+		return c.Render("templates/life_stages", fiber.Map{
+			"Title": f.Name + " Life Stages",
+			"Farm":  f,
+			"Rules": rules,
+		})
+	}
+}
+
+func updateLifeStageRules(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		weaning, err := strconv.Atoi(c.FormValue("weaning_months"))
+		if err != nil {
+			return apperr.Validation("weaning age must be a number of months")
+		}
+		mature, err := strconv.Atoi(c.FormValue("mature_age"))
+		if err != nil {
+			return apperr.Validation("age of maturity must be a number of years")
+		}
+		rules := lifestage.Rules{
+			RegistryAging: c.FormValue("registry_aging") == "on",
+			WeaningMonths: weaning,
+			MatureAge:     mature,
+		}
+		if err := farm.SaveLifeStageRules(c.UserContext(), db, f.ID, rules); err != nil {
+			if errors.Is(err, lifestage.ErrInvalidRules) {
+				return apperr.Validation(err.Error())
+			}
+			return apperr.Internal("failed to save life stage rules", err)
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s", f.ID))
+	}
+}
+
 func getHorses(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		// TODO: implement
@@ -67,35 +351,150 @@ func getHorses(db *database.DB) func(*fiber.Ctx) error {
 	}
 }
 
-func getHorse(db *database.DB) func(*fiber.Ctx) error {
+// farmHorse loads the :id horse, making sure it belongs to the :farmID farm
+// that the farm owner middleware has already authorized.
+func farmHorse(c *fiber.Ctx, db *database.DB) (*Horse, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, apperr.Validation("invalid horse ID")
+	}
+	h, err := GetHorse(c.UserContext(), db, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperr.NotFound("horse not found")
+	}
+	if err != nil {
+		return nil, apperr.Internal("failed to get horse", err)
+	}
+	if h.FarmID.String() != c.Params("farmID") {
+		return nil, apperr.NotFound("horse not found")
+	}
+	return h, nil
+}
+
+// blankBreedRows is how many breeds the details form can add at once
+const blankBreedRows = 2
+
+func getHorse(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		// TODO: implement
-		return c.SendStatus(fiber.StatusNotImplemented)
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		h.Images, err = GetImages(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get images", err)
+		}
+		if err := ResolveImageURLs(c.UserContext(), store, h.Images); err != nil {
+			return apperr.Internal("failed to sign image urls", err)
+		}
+		docs, err := GetDocuments(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get documents", err)
+		}
+
+		generations := c.QueryInt("generations", DefaultGenerations)
+		generations = min(max(generations, 1), MaxGenerations)
+		ancestors, err := GetAncestors(c.UserContext(), db, h.ID, generations)
+		if err != nil {
+			return apperr.Internal("failed to get ancestors", err)
+		}
+		self := ancestors[h.ID]
+		offspring, err := GetOffspring(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get offspring", err)
+		}
+		siblings, err := GetSiblings(c.UserContext(), db, self)
+		if err != nil {
+			return apperr.Internal("failed to get siblings", err)
+		}
+		candidates, err := GetFarmAncestors(c.UserContext(), db, h.FarmID)
+		if err != nil {
+			return apperr.Internal("failed to get ancestors", err)
+		}
+		common, err := GetCommonAncestors(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get common ancestors", err)
+		}
+		tests, err := GetGeneticTests(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get genetic tests", err)
+		}
+		breeds, err := GetBreeds(c.UserContext(), db)
+		if err != nil {
+			return apperr.Internal("failed to get breeds", err)
+		}
+		genderHistory, err := GetGenderHistory(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get gender history", err)
+		}
+		statusHistory, err := GetStatusHistory(c.UserContext(), db, h.ID)
+		if err != nil {
+			return apperr.Internal("failed to get status history", err)
+		}
+
+		return c.Render("templates/horse", fiber.Map{
+			"Self":          self,
+			"Title":         h.Name,
+			"Horse":         h,
+			"Documents":     docs,
+			"Pedigree":      BuildPedigree(h.ID, ancestors, generations),
+			"Offspring":     offspring,
+			"Siblings":      siblings,
+			"Candidates":    candidates,
+			"Generations":   generations,
+			"Common":        common,
+			"Tests":         tests,
+			"Conditions":    Conditions,
+			"Results":       TestResults,
+			"Breeds":        breeds,
+			"Precisions":    lifestage.Precisions,
+			"Genders":       ValidGenders,
+			"GenderHistory": genderHistory,
+			"Statuses":      Statuses,
+			"StatusHistory": statusHistory,
+			// Empty rows for adding breeds below the recorded shares
+			"BlankBreedRows": make([]struct{}, blankBreedRows),
+		})
 	}
 }
 
-func createHorse(db *database.DB) func(*fiber.Ctx) error {
+func createHorse(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		var h Horse
 		if err := c.BodyParser(&h); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return apperr.Validation(err.Error())
 		}
-		dateStr := c.FormValue("date_of_birth")
-		if dateStr != "" {
-			dob, err := utils.ParseDate(dateStr)
-			if err != nil {
-				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
-			}
-			h.DateOfBirth = dob
+		precision := lifestage.Precision(c.FormValue("birth_date_precision", string(lifestage.PrecisionExact)))
+		birth, err := lifestage.ParseBirthDate(strings.TrimSpace(c.FormValue("date_of_birth")), precision)
+		if err != nil {
+			return apperr.Validation(err.Error())
+		}
+		h.Birth = birth
+		height, err := ParseHeight(c.FormValue("height"))
+		if err != nil {
+			return apperr.Validation(err.Error())
 		}
+		h.Height = height
 		farmIDStr := c.Params("farmID")
 		farmID, err := uuid.Parse(farmIDStr)
 		if err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid farm ID"})
+			return apperr.Validation("invalid farm ID")
 		}
 		h.FarmID = farmID
-		if err := h.Save(c.Context(), db); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if err := h.Save(c.UserContext(), db); err != nil {
+			return apperr.Internal("failed to save horse", err)
+		}
+		if form, err := c.MultipartForm(); err == nil {
+			for _, fh := range form.File["images"] {
+				if _, err := AddImage(c.UserContext(), db, store, &h, fh, h.Name); err != nil {
+					return uploadError(err, "failed to save image")
+				}
+			}
+		}
+		addedBy := c.Locals("user").(*user.User)
+		if err := EnqueueAddedNotice(c.UserContext(), db, &h, addedBy); err != nil {
+			// The horse is saved; the other members just miss the email
+			logging.From(c).Error("failed to enqueue horse added notice", "horse_id", h.ID, "error", err)
 		}
 		return c.Status(fiber.StatusCreated).JSON(h)
 	}
@@ -114,3 +513,657 @@ func deleteHorse(db *database.DB) func(*fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusNotImplemented)
 	}
 }
+
+// setHorseDetails saves the details form. Breed shares arrive as parallel
+// breed_id and percent fields, and rows left blank are skipped.
+func setHorseDetails(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		precision := lifestage.Precision(c.FormValue("birth_date_precision"))
+		if h.Birth, err = lifestage.ParseBirthDate(strings.TrimSpace(c.FormValue("date_of_birth")), precision); err != nil {
+			return apperr.Validation(err.Error())
+		}
+		h.Color = strings.TrimSpace(c.FormValue("color"))
+		h.Markings = strings.TrimSpace(c.FormValue("markings"))
+		if h.Height, err = ParseHeight(c.FormValue("height")); err != nil {
+			return apperr.Validation(err.Error())
+		}
+		args := c.Context().PostArgs()
+		breedIDs, percents := args.PeekMulti("breed_id"), args.PeekMulti("percent")
+		if len(breedIDs) != len(percents) {
+			return apperr.Validation("each breed needs a percentage")
+		}
+		h.Breeds = nil
+		for i := range breedIDs {
+			if len(breedIDs[i]) == 0 {
+				continue
+			}
+			id, err := uuid.ParseBytes(breedIDs[i])
+			if err != nil {
+				return apperr.Validation("invalid breed ID")
+			}
+			percent, err := strconv.Atoi(string(percents[i]))
+			if err != nil {
+				return apperr.Validation("breed percentages must be whole numbers")
+			}
+			h.Breeds = append(h.Breeds, &BreedShare{Breed: Breed{ID: id}, Percent: percent})
+		}
+		if err := UpdateDetails(c.UserContext(), db, h); err != nil {
+			if errors.Is(err, ErrInvalidBreeds) {
+				return apperr.Validation(err.Error())
+			}
+			return apperr.Internal("failed to update horse details", err)
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+// changeHorseGender records a gelding or a reclassification between
+// stallion and ridgling.
+func changeHorseGender(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		to, err := strconv.Atoi(c.FormValue("gender"))
+		if err != nil {
+			return apperr.Validation("choose the new sex")
+		}
+		changedOn, err := utils.ParseDate(c.FormValue("changed_on"))
+		if err != nil {
+			return apperr.Validation("date must be YYYY-MM-DD")
+		}
+		note := strings.TrimSpace(c.FormValue("note"))
+		if err := ChangeGender(c.UserContext(), db, h, Gender(to), changedOn, note); err != nil {
+			if errors.Is(err, ErrInvalidGenderChange) {
+				return apperr.Validation(fmt.Sprintf("%s cannot become a %s on that date", h.Gender, Gender(to)))
+			}
+			return apperr.Internal("failed to change gender", err)
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func changeHorseStatus(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		to := Status(c.FormValue("status"))
+		changedOn, err := utils.ParseDate(c.FormValue("changed_on"))
+		if err != nil {
+			return apperr.Validation("date must be YYYY-MM-DD")
+		}
+		reason := strings.TrimSpace(c.FormValue("reason"))
+		if reason == "" {
+			return apperr.Validation("give a reason for the change")
+		}
+		if err := ChangeStatus(c.UserContext(), db, h, to, changedOn, reason); err != nil {
+			if errors.Is(err, ErrInvalidStatusChange) {
+				return apperr.Validation(fmt.Sprintf(
+					"a %s horse cannot become %s on that date, which must fall between its birth, or its last change of status, and today",
+					h.Status.Label(), to.Label(),
+				))
+			}
+			return apperr.Internal("failed to change status", err)
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+// parseParentID reads an optional sire or dam form field, where empty means
+// unknown.
+func parseParentID(c *fiber.Ctx, field string) (uuid.UUID, error) {
+	v := c.FormValue(field)
+	if v == "" {
+		return uuid.Nil, nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return uuid.Nil, apperr.Validation("invalid " + field)
+	}
+	return id, nil
+}
+
+// setParents applies the sire_id and dam_id form fields to child.
+func setParents(c *fiber.Ctx, db *database.DB, child *Ancestor) error {
+	sireID, err := parseParentID(c, "sire_id")
+	if err != nil {
+		return err
+	}
+	damID, err := parseParentID(c, "dam_id")
+	if err != nil {
+		return err
+	}
+	err = SetParents(c.UserContext(), db, child, sireID, damID)
+	if errors.Is(err, ErrInvalidParent) {
+		return apperr.Validation(err.Error())
+	}
+	if err != nil {
+		return apperr.Internal("failed to set parents", err)
+	}
+	return nil
+}
+
+func setHorseParents(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		child, err := GetAncestor(c.UserContext(), db, h.ID)
+		if err != nil || child == nil {
+			return apperr.Internal("failed to get horse", err)
+		}
+		if err := setParents(c, db, child); err != nil {
+			return err
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+// queryAncestor loads the farm's horse or external ancestor named by a
+// query parameter, or returns nil if the parameter is empty.
+func queryAncestor(c *fiber.Ctx, db *database.DB, farmID uuid.UUID, param string) (*Ancestor, error) {
+	return farmAncestor(c, db, farmID, param, c.Query(param))
+}
+
+// farmAncestor loads the farm's horse or external ancestor with the ID v,
+// or returns nil if v is empty. name describes it in errors.
+func farmAncestor(c *fiber.Ctx, db *database.DB, farmID uuid.UUID, name, v string) (*Ancestor, error) {
+	if v == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(v)
+	if err != nil {
+		return nil, apperr.Validation("invalid " + name)
+	}
+	a, err := GetAncestor(c.UserContext(), db, id)
+	if err != nil {
+		return nil, apperr.Internal("failed to get "+name, err)
+	}
+	if a == nil || a.FarmID != farmID {
+		return nil, apperr.NotFound(name + " not found")
+	}
+	return a, nil
+}
+
+// getBreedingPlanner ranks the farm's stallions for a chosen mare and,
+// with a stallion chosen too, shows that pairing in detail.
+func getBreedingPlanner(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		candidates, err := GetBreedingCandidates(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get horses", err)
+		}
+		var mares, stallions []*Ancestor
+		for _, a := range candidates {
+			if a.CanDam() && !a.External {
+				mares = append(mares, a)
+			}
+			if a.Gender.IsEntire() {
+				stallions = append(stallions, a)
+			}
+		}
+
+		mare, err := queryAncestor(c, db, f.ID, "mare")
+		if err != nil {
+			return err
+		}
+		stallion, err := queryAncestor(c, db, f.ID, "stallion")
+		if err != nil {
+			return err
+		}
+		if mare != nil && !mare.CanDam() {
+			return apperr.Validation(mare.Name + " is not a mare")
+		}
+		if stallion != nil && !stallion.Gender.IsEntire() {
+			return apperr.Validation(stallion.Name + " is not a stallion")
+		}
+
+		records, err := GetBreedingRecords(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get breeding records", err)
+		}
+
+		var ranking []*Pairing
+		var pairing *Pairing
+		if mare != nil {
+			ranking, err = RankStallions(c.UserContext(), db, mare)
+			if err != nil {
+				return apperr.Internal("failed to rank stallions", err)
+			}
+			if stallion != nil {
+				pairings, err := PlanPairings(c.UserContext(), db, mare, []*Ancestor{stallion})
+				if err != nil {
+					return apperr.Internal("failed to plan pairing", err)
+				}
+				pairing = pairings[0]
+			}
+		}
+
+		return c.Render("templates/breeding", fiber.Map{
+			"Title":     f.Name + " Breeding Planner",
+			"Farm":      f,
+			"Mares":     mares,
+			"Stallions": stallions,
+			"Mare":      mare,
+			"Stallion":  stallion,
+			"Ranking":   ranking,
+			"Pairing":   pairing,
+			"Records":   records,
+		})
+	}
+}
+
+func addBreedingRecord(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		mare, err := farmAncestor(c, db, f.ID, "mare", c.FormValue("mare"))
+		if err != nil {
+			return err
+		}
+		stallion, err := farmAncestor(c, db, f.ID, "stallion", c.FormValue("stallion"))
+		if err != nil {
+			return err
+		}
+		if mare == nil || stallion == nil {
+			return apperr.Validation("choose a mare and a stallion")
+		}
+		coveredOn, err := utils.ParseDate(c.FormValue("covered_on"))
+		if err != nil {
+			return apperr.Validation("date must be YYYY-MM-DD")
+		}
+		note := strings.TrimSpace(c.FormValue("note"))
+		if _, err := AddBreedingRecord(c.UserContext(), db, mare, stallion, coveredOn, note); err != nil {
+			if errors.Is(err, ErrInvalidBreedingRecord) {
+				return apperr.Validation(fmt.Sprintf("%s cannot be recorded as covered by %s on that date", mare.Name, stallion.Name))
+			}
+			return apperr.Internal("failed to save breeding record", err)
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/breeding", f.ID))
+	}
+}
+
+func deleteBreedingRecord(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		recordID, err := uuid.Parse(c.Params("recordID"))
+		if err != nil {
+			return apperr.Validation("invalid breeding record ID")
+		}
+		ok, err := DeleteBreedingRecord(c.UserContext(), db, f.ID, recordID)
+		if err != nil {
+			return apperr.Internal("failed to delete breeding record", err)
+		}
+		if !ok {
+			return apperr.NotFound("breeding record not found")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/breeding", f.ID))
+	}
+}
+
+func getExternalAncestors(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		external, err := GetExternalAncestors(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get external ancestors", err)
+		}
+		candidates, err := GetFarmAncestors(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get ancestors", err)
+		}
+		return c.Render("templates/ancestors", fiber.Map{
+			"Title":      f.Name + " External Ancestors",
+			"Farm":       f,
+			"Ancestors":  external,
+			"Candidates": candidates,
+			"Genders":    ValidGenders,
+		})
+	}
+}
+
+func createExternalAncestor(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		farmID, err := uuid.Parse(c.Params("farmID"))
+		if err != nil {
+			return apperr.Validation("invalid farm ID")
+		}
+		a := &Ancestor{
+			FarmID:             farmID,
+			Name:               strings.TrimSpace(c.FormValue("name")),
+			RegistrationNumber: strings.TrimSpace(c.FormValue("registration_number")),
+		}
+		if a.Name == "" {
+			return apperr.Validation("name is required")
+		}
+		gender, err := strconv.Atoi(c.FormValue("gender"))
+		if err != nil || Gender(gender).IsInvalid() {
+			return apperr.Validation("choose a gender")
+		}
+		a.Gender = Gender(gender)
+		if v := c.FormValue("birth_year"); v != "" {
+			a.BirthYear, err = strconv.Atoi(v)
+			if err != nil || a.BirthYear < 1000 || a.BirthYear > time.Now().Year() {
+				return apperr.Validation("birth year must be a year such as 1998")
+			}
+		}
+		if err := NewExternalAncestor(c.UserContext(), db, a); err != nil {
+			return apperr.Internal("failed to save external ancestor", err)
+		}
+		if err := setParents(c, db, a); err != nil {
+			return err
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/ancestors", farmID))
+	}
+}
+
+// farmExternalAncestor loads the :ancestorID external ancestor, making sure
+// it belongs to the :farmID farm.
+func farmExternalAncestor(c *fiber.Ctx, db *database.DB) (*Ancestor, error) {
+	id, err := uuid.Parse(c.Params("ancestorID"))
+	if err != nil {
+		return nil, apperr.Validation("invalid ancestor ID")
+	}
+	a, err := GetAncestor(c.UserContext(), db, id)
+	if err != nil {
+		return nil, apperr.Internal("failed to get ancestor", err)
+	}
+	if a == nil || !a.External || a.FarmID.String() != c.Params("farmID") {
+		return nil, apperr.NotFound("ancestor not found")
+	}
+	return a, nil
+}
+
+func setAncestorParents(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		a, err := farmExternalAncestor(c, db)
+		if err != nil {
+			return err
+		}
+		if err := setParents(c, db, a); err != nil {
+			return err
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/ancestors", a.FarmID))
+	}
+}
+
+// setGenotype applies a coat color genotype form, with a field per locus
+// symbol left empty when untested, to a.
+func setGenotype(c *fiber.Ctx, db *database.DB, a *Ancestor) error {
+	g := coatcolor.Genotype{}
+	for _, l := range coatcolor.Loci {
+		if v := c.FormValue(l.Symbol); v != "" {
+			g[l.Symbol] = v
+		}
+	}
+	if err := g.Validate(); err != nil {
+		return apperr.Validation(err.Error())
+	}
+	if err := SetGenotype(c.UserContext(), db, a, g); err != nil {
+		return apperr.Internal("failed to set genotype", err)
+	}
+	return nil
+}
+
+func setHorseGenotype(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		a, err := GetAncestor(c.UserContext(), db, h.ID)
+		if err != nil || a == nil {
+			return apperr.Internal("failed to get horse", err)
+		}
+		if err := setGenotype(c, db, a); err != nil {
+			return err
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func setAncestorGenotype(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		a, err := farmExternalAncestor(c, db)
+		if err != nil {
+			return err
+		}
+		if err := setGenotype(c, db, a); err != nil {
+			return err
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/ancestors", a.FarmID))
+	}
+}
+
+// getColorCalculator predicts the coat colors of a foal of any stallion
+// and mare known to the farm, leaving out its sold and deceased horses.
+func getColorCalculator(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		f, err := farm.GetFarm(c.UserContext(), db, c.Params("farmID"))
+		if err != nil {
+			return apperr.NotFound("farm not found")
+		}
+		candidates, err := GetBreedingCandidates(c.UserContext(), db, f.ID)
+		if err != nil {
+			return apperr.Internal("failed to get horses", err)
+		}
+		var mares, stallions []*Ancestor
+		for _, a := range candidates {
+			if a.CanDam() {
+				mares = append(mares, a)
+			}
+			if a.Gender.IsEntire() {
+				stallions = append(stallions, a)
+			}
+		}
+		mare, err := queryAncestor(c, db, f.ID, "mare")
+		if err != nil {
+			return err
+		}
+		stallion, err := queryAncestor(c, db, f.ID, "stallion")
+		if err != nil {
+			return err
+		}
+		var prediction *coatcolor.Prediction
+		if mare != nil && stallion != nil {
+			prediction = coatcolor.Predict(stallion.Genotype, mare.Genotype)
+		}
+		return c.Render("templates/colors", fiber.Map{
+			"Title":      f.Name + " Coat Color Calculator",
+			"Farm":       f,
+			"Mares":      mares,
+			"Stallions":  stallions,
+			"Mare":       mare,
+			"Stallion":   stallion,
+			"Prediction": prediction,
+		})
+	}
+}
+
+// uploadError maps a failed upload to a validation error when the file was
+// at fault.
+func uploadError(err error, msg string) error {
+	if errors.Is(err, ErrUnsupportedType) {
+		return apperr.Validation(err.Error())
+	}
+	return apperr.Internal(msg, err)
+}
+
+func uploadImages(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		form, err := c.MultipartForm()
+		if err != nil || len(form.File["images"]) == 0 {
+			return apperr.Validation("choose at least one image to upload")
+		}
+		alt := strings.TrimSpace(c.FormValue("alt"))
+		if alt == "" {
+			alt = h.Name
+		}
+		for _, fh := range form.File["images"] {
+			if _, err := AddImage(c.UserContext(), db, store, h, fh, alt); err != nil {
+				return uploadError(err, "failed to save image")
+			}
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func deleteImage(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		imageID, err := uuid.Parse(c.Params("imageID"))
+		if err != nil {
+			return apperr.Validation("invalid image ID")
+		}
+		ok, err := DeleteImage(c.UserContext(), db, store, h.ID, imageID)
+		if err != nil {
+			return apperr.Internal("failed to delete image", err)
+		}
+		if !ok {
+			return apperr.NotFound("image not found")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func uploadDocument(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		fh, err := c.FormFile("document")
+		if err != nil {
+			return apperr.Validation("choose a document to upload")
+		}
+		if _, err := AddDocument(c.UserContext(), db, store, h, fh); err != nil {
+			return uploadError(err, "failed to save document")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+// downloadDocument redirects to a short lived signed link rather than
+// streaming the file through the server.
+func downloadDocument(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		docID, err := uuid.Parse(c.Params("docID"))
+		if err != nil {
+			return apperr.Validation("invalid document ID")
+		}
+		doc, err := GetDocument(c.UserContext(), db, h.ID, docID)
+		if err != nil {
+			return apperr.Internal("failed to get document", err)
+		}
+		if doc == nil {
+			return apperr.NotFound("document not found")
+		}
+		u, err := doc.DownloadURL(c.UserContext(), store)
+		if err != nil {
+			return apperr.Internal("failed to sign document url", err)
+		}
+		return c.Redirect(u)
+	}
+}
+
+func deleteDocument(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		docID, err := uuid.Parse(c.Params("docID"))
+		if err != nil {
+			return apperr.Validation("invalid document ID")
+		}
+		ok, err := DeleteDocument(c.UserContext(), db, store, h.ID, docID)
+		if err != nil {
+			return apperr.Internal("failed to delete document", err)
+		}
+		if !ok {
+			return apperr.NotFound("document not found")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func addGeneticTest(db *database.DB, store storage.Store) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		testedOn, err := utils.ParseDate(c.FormValue("tested_on"))
+		if err != nil {
+			return apperr.Validation("test date must be YYYY-MM-DD")
+		}
+		t := &GeneticTest{
+			Condition: Condition(c.FormValue("condition")),
+			Result:    TestResult(c.FormValue("result")),
+			Lab:       strings.TrimSpace(c.FormValue("lab")),
+			TestedOn:  testedOn,
+			Public:    c.FormValue("public") == "on",
+		}
+		// The certificate is optional
+		certificate, _ := c.FormFile("certificate")
+		if err := AddGeneticTest(c.UserContext(), db, store, h, t, certificate); err != nil {
+			if errors.Is(err, ErrInvalidTest) {
+				return apperr.Validation("choose a condition, result and test date")
+			}
+			return uploadError(err, "failed to save genetic test")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
+
+func deleteGeneticTest(db *database.DB) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		h, err := farmHorse(c, db)
+		if err != nil {
+			return err
+		}
+		testID, err := uuid.Parse(c.Params("testID"))
+		if err != nil {
+			return apperr.Validation("invalid test ID")
+		}
+		ok, err := DeleteGeneticTest(c.UserContext(), db, h.ID, testID)
+		if err != nil {
+			return apperr.Internal("failed to delete genetic test", err)
+		}
+		if !ok {
+			return apperr.NotFound("genetic test not found")
+		}
+		return c.Redirect(fmt.Sprintf("/farm/%s/horse/%s", h.FarmID, h.ID))
+	}
+}
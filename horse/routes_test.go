@@ -0,0 +1,59 @@
+package horse
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+func TestParseFilter(t *testing.T) {
+	breed := uuid.New()
+	tests := []struct {
+		name    string
+		query   string
+		parse   func(*fiber.Ctx) (Filter, error)
+		want    Filter
+		wantErr bool
+	}{
+		{name: "empty", query: "", parse: parseFilter, want: Filter{}},
+		{
+			name:  "every field",
+			query: "breed=" + breed.String() + "&color=+Bay+&min_height=14.2&max_height=160cm&status=for_sale&sort=age",
+			parse: parseFilter,
+			want:  Filter{BreedID: breed, Color: "Bay", MinHeight: 14.5, MaxHeight: 15.75, Status: StatusForSale, Sort: SortAge},
+		},
+		{name: "all statuses", query: "status=all", parse: parseFilter, want: Filter{Status: StatusAll}},
+		{name: "bad status", query: "status=stolen", parse: parseFilter, wantErr: true},
+		{name: "bad breed", query: "breed=friesian", parse: parseFilter, wantErr: true},
+		{name: "bad height", query: "min_height=tall", parse: parseFilter, wantErr: true},
+		{name: "bad sort", query: "sort=price", parse: parseFilter, wantErr: true},
+		{
+			name:  "listing ignores status",
+			query: "color=black&status=sold",
+			parse: parseListingFilter,
+			want:  Filter{Color: "black"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Filter
+			var err error
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				got, err = tt.parse(c)
+				return nil
+			})
+			if _, testErr := app.Test(httptest.NewRequest(fiber.MethodGet, "/?"+tt.query, nil)); testErr != nil {
+				t.Fatalf("request failed: %v", testErr)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
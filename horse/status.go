@@ -0,0 +1,177 @@
+package horse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+// Status is where a horse is in its life with the farm.
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusForSale  Status = "for_sale"
+	StatusSold     Status = "sold"
+	StatusLeased   Status = "leased"
+	StatusRetired  Status = "retired"
+	StatusDeceased Status = "deceased"
+)
+
+// Statuses lists every Status, in the order a form should offer them.
+var Statuses = []Status{StatusActive, StatusForSale, StatusLeased, StatusRetired, StatusSold, StatusDeceased}
+
+func (s Status) IsValid() bool {
+	return slices.Contains(Statuses, s)
+}
+
+func (s Status) Label() string {
+	switch s {
+	case StatusActive:
+		return "Active"
+	case StatusForSale:
+		return "For sale"
+	case StatusSold:
+		return "Sold"
+	case StatusLeased:
+		return "Leased"
+	case StatusRetired:
+		return "Retired"
+	case StatusDeceased:
+		return "Deceased"
+	}
+	return string(s)
+}
+
+// InInventory reports whether horses with the status are still the farm's
+// to care for. Sold and deceased horses keep their records but drop out of
+// counts and listings.
+func (s Status) InInventory() bool {
+	return s != StatusSold && s != StatusDeceased
+}
+
+// inventoryStatuses lists the statuses in inventory, as a query argument.
+func inventoryStatuses() []string {
+	var statuses []string
+	for _, s := range Statuses {
+		if s.InInventory() {
+			statuses = append(statuses, string(s))
+		}
+	}
+	return statuses
+}
+
+// CanBecome reports whether a horse may move from s to to. Death is final;
+// a sold horse may be bought back.
+func (s Status) CanBecome(to Status) bool {
+	return to.IsValid() && s != to && s != StatusDeceased
+}
+
+// StatusEvent is a dated change of a horse's status.
+type StatusEvent struct {
+	ID        uuid.UUID `db:"id"`
+	HorseID   uuid.UUID `db:"horse_id"`
+	From      Status    `db:"from_status"`
+	To        Status    `db:"to_status"`
+	ChangedOn time.Time `db:"changed_on"`
+	Reason    string    `db:"reason"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ErrInvalidStatusChange is returned for a change Status.CanBecome does not
+// allow, without a reason, or dated in the future, before the horse was
+// born or before its last change of status.
+var ErrInvalidStatusChange = errors.New("invalid change of status")
+
+// ChangeStatus moves h to a new status as of changedOn, recording the
+// change and its reason.
+func ChangeStatus(ctx context.Context, db *database.DB, h *Horse, to Status, changedOn time.Time, reason string) error {
+	defer metrics.TimeQuery("horse.ChangeStatus")()
+
+	if !h.Status.CanBecome(to) || reason == "" || changedOn.After(time.Now()) {
+		return ErrInvalidStatusChange
+	}
+	if h.Birth.IsKnown() && changedOn.Before(h.Birth.Date) {
+		return ErrInvalidStatusChange
+	}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		// History must read in order, so a change can't predate the last
+		var last *time.Time
+		err := tx.QueryRow(
+			ctx,
+			`SELECT max(changed_on) FROM horse_status_events WHERE horse_id = $1`,
+			h.ID,
+		).Scan(&last)
+		if err != nil {
+			return fmt.Errorf("failed to get last status change: %w", err)
+		}
+		if last != nil && changedOn.Before(*last) {
+			return ErrInvalidStatusChange
+		}
+		// Checking the old status stops two changes racing
+		tag, err := tx.Exec(
+			ctx,
+			`UPDATE horses SET status = $3 WHERE id = $1 AND status = $2`,
+			h.ID,     // $1
+			h.Status, // $2
+			to,       // $3
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update status: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidStatusChange
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO horse_status_events (horse_id, from_status, to_status, changed_on, reason)
+			VALUES ($1, $2, $3, $4, $5)`,
+			h.ID,      // $1
+			h.Status,  // $2
+			to,        // $3
+			changedOn, // $4
+			reason,    // $5
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert status event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	h.Status = to
+	if to == StatusSold {
+		metrics.ListingsSold.Inc()
+	}
+	return nil
+}
+
+// GetStatusHistory returns the horse's changes of status, the earliest
+// first.
+func GetStatusHistory(ctx context.Context, db *database.DB, horseID uuid.UUID) ([]*StatusEvent, error) {
+	defer metrics.TimeQuery("horse.GetStatusHistory")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, horse_id, from_status, to_status, changed_on, reason, created_at
+		FROM horse_status_events WHERE horse_id = $1 ORDER BY changed_on, created_at`,
+		horseID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query status history: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[StatusEvent])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect status history: %w", err)
+	}
+	return events, nil
+}
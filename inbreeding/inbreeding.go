@@ -0,0 +1,154 @@
+// Package inbreeding computes Wright's coefficient of inbreeding from
+// recorded pedigrees by the path method.
+package inbreeding
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// DefaultGenerations is how far back paths to common ancestors are traced,
+// counting the foal's parents as the first generation.
+const DefaultGenerations = 10
+
+// Parents are the recorded sire and dam of a horse; either is uuid.Nil
+// when unknown.
+type Parents struct {
+	Sire uuid.UUID `db:"sire_id"`
+	Dam  uuid.UUID `db:"dam_id"`
+}
+
+// Pedigree maps horses to their parents. Horses missing from it are
+// treated as founders.
+type Pedigree map[uuid.UUID]Parents
+
+// CommonAncestor is an ancestor found on both the sire's and the dam's
+// side, with its share of the coefficient.
+type CommonAncestor struct {
+	ID           uuid.UUID
+	Contribution float64
+	// Paths counts the distinct routes through the pedigree that join the
+	// sire and dam at this ancestor
+	Paths int
+}
+
+type Result struct {
+	COI float64
+	// Common is ordered from the largest contribution down
+	Common []CommonAncestor
+}
+
+// Calculator computes coefficients over a pedigree, remembering the
+// coefficients of ancestors as it goes.
+type Calculator struct {
+	pedigree    Pedigree
+	generations int
+	memo        map[uuid.UUID]float64
+}
+
+func New(p Pedigree, generations int) *Calculator {
+	return &Calculator{pedigree: p, generations: generations, memo: map[uuid.UUID]float64{}}
+}
+
+// Horse returns the coefficient of inbreeding of a recorded horse.
+func (c *Calculator) Horse(id uuid.UUID) Result {
+	p := c.pedigree[id]
+	return c.Mating(p.Sire, p.Dam)
+}
+
+// Mating returns the coefficient a foal of sire and dam would have:
+//
+//	F = Σ (1/2)^(n1+n2+1) (1 + F_A)
+//
+// summed over every common ancestor A and every pair of paths from the
+// sire and from the dam to A that meet nowhere else, where n1 and n2 are
+// the generations along each path and F_A is A's own coefficient.
+func (c *Calculator) Mating(sire, dam uuid.UUID) Result {
+	if sire == uuid.Nil || dam == uuid.Nil {
+		return Result{}
+	}
+	sirePaths := c.paths(sire)
+	damPaths := c.paths(dam)
+
+	var r Result
+	for a, fromSire := range sirePaths {
+		fromDam, ok := damPaths[a]
+		if !ok {
+			continue
+		}
+		common := CommonAncestor{ID: a}
+		fa := c.coefficient(a)
+		for _, p := range fromSire {
+			for _, q := range fromDam {
+				if !disjoint(p, q) {
+					continue
+				}
+				n := len(p) - 1 + len(q) - 1
+				common.Contribution += math.Pow(0.5, float64(n+1)) * (1 + fa)
+				common.Paths++
+			}
+		}
+		if common.Paths > 0 {
+			r.COI += common.Contribution
+			r.Common = append(r.Common, common)
+		}
+	}
+	slices.SortFunc(r.Common, func(x, y CommonAncestor) int {
+		if c := cmp.Compare(y.Contribution, x.Contribution); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.ID.String(), y.ID.String())
+	})
+	return r
+}
+
+// coefficient returns the coefficient of ancestor id, which weights the
+// paths meeting at it.
+func (c *Calculator) coefficient(id uuid.UUID) float64 {
+	if f, ok := c.memo[id]; ok {
+		return f
+	}
+	// Guards against a cycle, which the app never records
+	c.memo[id] = 0
+	f := c.Horse(id).COI
+	c.memo[id] = f
+	return f
+}
+
+// paths lists, for every ancestor of start within the generation limit
+// and start itself, the routes up to it. Each route begins at start and
+// ends at the ancestor.
+func (c *Calculator) paths(start uuid.UUID) map[uuid.UUID][][]uuid.UUID {
+	found := map[uuid.UUID][][]uuid.UUID{}
+	var walk func(path []uuid.UUID)
+	walk = func(path []uuid.UUID) {
+		id := path[len(path)-1]
+		found[id] = append(found[id], slices.Clone(path))
+		// start is the first generation
+		if len(path) >= c.generations {
+			return
+		}
+		p := c.pedigree[id]
+		for _, parent := range []uuid.UUID{p.Sire, p.Dam} {
+			if parent != uuid.Nil && !slices.Contains(path, parent) {
+				walk(append(path, parent))
+			}
+		}
+	}
+	walk([]uuid.UUID{start})
+	return found
+}
+
+// disjoint reports whether two paths ending at the same ancestor share no
+// other horse.
+func disjoint(p, q []uuid.UUID) bool {
+	for _, x := range p[:len(p)-1] {
+		if slices.Contains(q[:len(q)-1], x) {
+			return false
+		}
+	}
+	return true
+}
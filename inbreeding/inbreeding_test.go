@@ -0,0 +1,80 @@
+package inbreeding
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMating(t *testing.T) {
+	var (
+		grandsire = uuid.New()
+		granddam  = uuid.New()
+		other1    = uuid.New()
+		other2    = uuid.New()
+		sire      = uuid.New()
+		dam       = uuid.New()
+	)
+	tests := []struct {
+		name       string
+		pedigree   Pedigree
+		wantCOI    float64
+		wantCommon int
+	}{
+		{
+			name: "unrelated",
+			pedigree: Pedigree{
+				sire: {Sire: grandsire, Dam: granddam},
+				dam:  {Sire: other1, Dam: other2},
+			},
+			wantCOI:    0,
+			wantCommon: 0,
+		},
+		{
+			name: "half siblings",
+			pedigree: Pedigree{
+				sire: {Sire: grandsire, Dam: other1},
+				dam:  {Sire: grandsire, Dam: other2},
+			},
+			wantCOI:    0.125,
+			wantCommon: 1,
+		},
+		{
+			name: "full siblings",
+			pedigree: Pedigree{
+				sire: {Sire: grandsire, Dam: granddam},
+				dam:  {Sire: grandsire, Dam: granddam},
+			},
+			wantCOI:    0.25,
+			wantCommon: 2,
+		},
+		{
+			name: "parent and offspring",
+			pedigree: Pedigree{
+				sire: {Sire: grandsire, Dam: granddam},
+				dam:  {Sire: sire, Dam: other1},
+			},
+			wantCOI:    0.25,
+			wantCommon: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(tt.pedigree, DefaultGenerations).Mating(sire, dam)
+			if math.Abs(r.COI-tt.wantCOI) > 1e-9 {
+				t.Errorf("COI = %v, want %v", r.COI, tt.wantCOI)
+			}
+			if len(r.Common) != tt.wantCommon {
+				t.Errorf("got %d common ancestors, want %d", len(r.Common), tt.wantCommon)
+			}
+		})
+	}
+}
+
+func TestMatingUnknownParent(t *testing.T) {
+	r := New(Pedigree{}, DefaultGenerations).Mating(uuid.New(), uuid.Nil)
+	if r.COI != 0 || len(r.Common) != 0 {
+		t.Errorf("Mating with an unknown dam = %+v, want zero", r)
+	}
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusDead    Status = "dead"
+)
+
+type Job struct {
+	ID          uuid.UUID       `db:"id"`
+	Kind        string          `db:"kind"`
+	Payload     json.RawMessage `db:"payload"`
+	Status      Status          `db:"status"`
+	Attempts    int             `db:"attempts"`
+	MaxAttempts int             `db:"max_attempts"`
+	RunAt       time.Time       `db:"run_at"`
+	LastError   string          `db:"last_error"`
+	CreatedAt   time.Time       `db:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at"`
+}
+
+// jobColumns lists the columns scanned into a Job by name
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+
+// Decode unmarshals the job's payload into v.
+func (j *Job) Decode(v any) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode %s payload: %w", j.Kind, err)
+	}
+	return nil
+}
+
+// Execer is satisfied by both *database.DB and pgx.Tx, so a job can be
+// enqueued inside the transaction that makes it necessary and will only
+// exist if that transaction commits.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Enqueue adds a job of the given kind. A non-empty idempotencyKey makes
+// repeated calls with the same key enqueue the job only once.
+func Enqueue(ctx context.Context, db Execer, kind, idempotencyKey string, payload any) error {
+	defer metrics.TimeQuery("jobs.Enqueue")()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %w", kind, err)
+	}
+	_, err = db.Exec(
+		ctx,
+		`INSERT INTO jobs (kind, payload, idempotency_key) VALUES ($1, $2, NULLIF($3, ''))
+		ON CONFLICT (idempotency_key) DO NOTHING`,
+		kind,           // $1
+		data,           // $2
+		idempotencyKey, // $3
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s job: %w", kind, err)
+	}
+	return nil
+}
+
+// KindStats counts the jobs of one kind by status. Done only covers the last
+// day so that it reflects current throughput.
+type KindStats struct {
+	Kind    string `db:"kind"`
+	Pending int    `db:"pending"`
+	Running int    `db:"running"`
+	Done    int    `db:"done"`
+	Dead    int    `db:"dead"`
+}
+
+func GetStats(ctx context.Context, db *database.DB) ([]*KindStats, error) {
+	defer metrics.TimeQuery("jobs.GetStats")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT kind,
+			count(*) FILTER (WHERE status = 'pending') AS pending,
+			count(*) FILTER (WHERE status = 'running') AS running,
+			count(*) FILTER (WHERE status = 'done' AND updated_at > now() - INTERVAL '24 hours') AS done,
+			count(*) FILTER (WHERE status = 'dead') AS dead
+		FROM jobs GROUP BY kind ORDER BY kind`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job stats: %w", err)
+	}
+	stats, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[KindStats])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect job stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetDeadJobs returns the most recently dead-lettered jobs, newest first.
+func GetDeadJobs(ctx context.Context, db *database.DB, limit int) ([]*Job, error) {
+	defer metrics.TimeQuery("jobs.GetDeadJobs")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+jobColumns+` FROM jobs WHERE status = 'dead' ORDER BY updated_at DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead jobs: %w", err)
+	}
+	jobs, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Job])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect dead jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Retry puts a dead job back in the queue with a fresh set of attempts. It
+// reports false if no dead job has that ID.
+func Retry(ctx context.Context, db *database.DB, id uuid.UUID) (bool, error) {
+	defer metrics.TimeQuery("jobs.Retry")()
+
+	tag, err := db.Exec(
+		ctx,
+		`UPDATE jobs SET status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+		WHERE id = $1 AND status = 'dead'`,
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to retry job: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// PurgeFinished deletes jobs that completed more than olderThan ago. Dead
+// jobs are kept until an admin has dealt with them.
+func PurgeFinished(ctx context.Context, db *database.DB, olderThan time.Duration) (int64, error) {
+	defer metrics.TimeQuery("jobs.PurgeFinished")()
+
+	tag, err := db.Exec(
+		ctx,
+		`DELETE FROM jobs WHERE status = 'done' AND updated_at < now() - $1::FLOAT8 * INTERVAL '1 second'`,
+		olderThan.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge finished jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,251 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/config"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+const (
+	// jobTimeout bounds a single attempt of a job
+	jobTimeout = 5 * time.Minute
+	// lockTimeout is how long a job may stay running before it is assumed
+	// that its worker died and another one may claim it
+	lockTimeout = 2 * jobTimeout
+	minBackoff  = 10 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Handler runs one job. Returning an error schedules a retry, or
+// dead-letters the job once it has used all of its attempts, so handlers
+// must be safe to run more than once.
+type Handler func(ctx context.Context, job *Job) error
+
+// Queue runs jobs from the jobs table. It implements the server's Worker
+// interface; handlers must all be registered before it starts.
+type Queue struct {
+	db       *database.DB
+	cfg      config.JobsConfig
+	handlers map[string]Handler
+}
+
+func NewQueue(db *database.DB, cfg config.JobsConfig) *Queue {
+	return &Queue{
+		db:       db,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler for a kind of job. It panics if the kind
+// already has one.
+func (q *Queue) Handle(kind string, h Handler) {
+	if _, ok := q.handlers[kind]; ok {
+		panic(fmt.Sprintf("jobs: handler for %q registered twice", kind))
+	}
+	q.handlers[kind] = h
+}
+
+func (q *Queue) Name() string {
+	return "jobs"
+}
+
+// Run polls for jobs with cfg.Concurrency workers until ctx is cancelled.
+func (q *Queue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range q.cfg.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("failed to claim job", "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.cfg.PollInterval):
+			}
+			continue
+		}
+		q.process(ctx, job)
+	}
+}
+
+// claim locks the next due job, skipping rows other workers hold, and marks
+// it running. It returns nil when there is nothing to do.
+func (q *Queue) claim(ctx context.Context) (*Job, error) {
+	defer metrics.TimeQuery("jobs.claim")()
+
+	var job *Job
+	err := pgx.BeginFunc(ctx, q.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(
+			ctx,
+			`SELECT `+jobColumns+` FROM jobs
+			WHERE (status = 'pending' AND run_at <= now())
+				OR (status = 'running' AND locked_at < now() - $1::FLOAT8 * INTERVAL '1 second')
+			ORDER BY run_at LIMIT 1
+			FOR UPDATE SKIP LOCKED`,
+			lockTimeout.Seconds(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to query due jobs: %w", err)
+		}
+		j, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Job])
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			return fmt.Errorf("failed to collect due job: %w", err)
+		}
+		row := tx.QueryRow(
+			ctx,
+			`UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_at = now(), updated_at = now()
+			WHERE id = $1 RETURNING status, attempts`,
+			j.ID,
+		)
+		if err := row.Scan(&j.Status, &j.Attempts); err != nil {
+			return fmt.Errorf("failed to lock job: %w", err)
+		}
+		job = j
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *Queue) process(ctx context.Context, job *Job) {
+	logger := slog.With("job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	start := time.Now()
+
+	err := q.run(ctx, job)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down: hand the job back without using up an attempt
+		q.release(job, logger)
+		return
+	}
+
+	outcome := string(StatusDone)
+	if err != nil {
+		outcome = "retry"
+		if job.Attempts >= job.MaxAttempts {
+			outcome = string(StatusDead)
+		}
+	}
+	metrics.ObserveJob(job.Kind, outcome, start)
+
+	// The worker context may be cancelled any moment now, but the result
+	// must still be written
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	switch {
+	case err == nil:
+		q.finish(finishCtx, job, StatusDone, 0, "", logger)
+	case job.Attempts >= job.MaxAttempts:
+		logger.Error("job failed, dead-lettering", "error", err)
+		q.finish(finishCtx, job, StatusDead, 0, err.Error(), logger)
+	default:
+		delay := backoff(job.Attempts)
+		logger.Warn("job failed, will retry", "error", err, "retry_in", delay.String())
+		q.finish(finishCtx, job, StatusPending, delay, err.Error(), logger)
+	}
+}
+
+// run calls the job's handler, turning a panic into an error so that one bad
+// job cannot take the worker down.
+func (q *Queue) run(ctx context.Context, job *Job) (err error) {
+	h, ok := q.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for %q", job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+	return h(ctx, job)
+}
+
+// finish records the outcome of the attempt at job. Nothing is written if
+// the job has been claimed again since, which happens when this attempt
+// outran lockTimeout; the attempt that now holds it will record its own.
+func (q *Queue) finish(ctx context.Context, job *Job, status Status, delay time.Duration, lastError string, logger *slog.Logger) {
+	ok, err := q.setOutcome(ctx, job, status, delay, lastError)
+	switch {
+	case err != nil:
+		logger.Error("failed to record job outcome", "status", status, "error", err)
+	case !ok:
+		logger.Warn("job was reclaimed by another worker, discarding outcome", "status", status)
+	}
+}
+
+// setOutcome updates job if this worker still holds it, which it does as
+// long as it is running on the attempt this worker claimed. It reports
+// whether it did.
+func (q *Queue) setOutcome(ctx context.Context, job *Job, status Status, delay time.Duration, lastError string) (bool, error) {
+	defer metrics.TimeQuery("jobs.finish")()
+
+	tag, err := q.db.Exec(
+		ctx,
+		`UPDATE jobs SET status = $1, run_at = now() + $2::FLOAT8 * INTERVAL '1 second',
+			last_error = $3, locked_at = NULL, updated_at = now()
+		WHERE id = $4 AND status = 'running' AND attempts = $5`,
+		status,          // $1
+		delay.Seconds(), // $2
+		lastError,       // $3
+		job.ID,          // $4
+		job.Attempts,    // $5
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update job: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (q *Queue) release(job *Job, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := q.db.Exec(
+		ctx,
+		`UPDATE jobs SET status = 'pending', attempts = attempts - 1, locked_at = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running' AND attempts = $2`,
+		job.ID,       // $1
+		job.Attempts, // $2
+	)
+	if err != nil {
+		logger.Error("failed to release job on shutdown", "error", err)
+	}
+}
+
+// backoff doubles the delay with every attempt, up to maxBackoff, and adds
+// some jitter so that jobs failing together do not retry together.
+func backoff(attempt int) time.Duration {
+	d := maxBackoff
+	if attempt < 16 {
+		d = min(minBackoff<<(attempt-1), maxBackoff)
+	}
+	return d + rand.N(d/5)
+}
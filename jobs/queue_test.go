@@ -0,0 +1,264 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/config"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/database/dbtest"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, minBackoff, minBackoff * 6 / 5},
+		{2, 2 * minBackoff, 2 * minBackoff * 6 / 5},
+		{4, 8 * minBackoff, 8 * minBackoff * 6 / 5},
+		{12, maxBackoff, maxBackoff * 6 / 5},
+		{40, maxBackoff, maxBackoff * 6 / 5},
+	}
+	for _, tt := range tests {
+		for range 20 {
+			if d := backoff(tt.attempt); d < tt.min || d >= tt.max {
+				t.Errorf("backoff(%d) = %s, want in [%s, %s)", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+// newTestQueue empties the jobs table, so that claims only see the jobs a
+// test enqueues, and returns a queue over it.
+func newTestQueue(t *testing.T) (*Queue, *database.DB) {
+	t.Helper()
+	db := dbtest.Open(t)
+	if _, err := db.Exec(context.Background(), `DELETE FROM jobs WHERE true`); err != nil {
+		t.Fatal(err)
+	}
+	return NewQueue(db, config.JobsConfig{Concurrency: 1, PollInterval: time.Second}), db
+}
+
+// enqueue adds a job and returns its ID.
+func enqueue(t *testing.T, db *database.DB, kind string) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	key := uuid.NewString()
+	if err := Enqueue(ctx, db, kind, key, map[string]string{"test": t.Name()}); err != nil {
+		t.Fatal(err)
+	}
+	var id uuid.UUID
+	if err := db.QueryRow(ctx, `SELECT id FROM jobs WHERE idempotency_key = $1`, key).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func getJob(t *testing.T, db *database.DB, id uuid.UUID) *Job {
+	t.Helper()
+	rows, err := db.Query(context.Background(), `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Job])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestEnqueueIdempotent(t *testing.T) {
+	_, db := newTestQueue(t)
+	ctx := context.Background()
+	for range 3 {
+		if err := Enqueue(ctx, db, "test.idempotent", "same-key", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var n int
+	if err := db.QueryRow(ctx, `SELECT count(*) FROM jobs WHERE idempotency_key = 'same-key'`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d jobs for one key, want 1", n)
+	}
+}
+
+func TestClaim(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+
+	later := enqueue(t, db, "test.claim")
+	if _, err := db.Exec(ctx, `UPDATE jobs SET run_at = now() + INTERVAL '1 hour' WHERE id = $1`, later); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.claim(ctx)
+	if err != nil || job != nil {
+		t.Fatalf("claim with nothing due = %v, %v; want nil", job, err)
+	}
+
+	due := enqueue(t, db, "test.claim")
+	job, err = q.claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != due || job.Status != StatusRunning || job.Attempts != 1 {
+		t.Fatalf("claim = %+v, want job %s running on attempt 1", job, due)
+	}
+	// A running job is not claimed again while its lock is fresh
+	if job, err := q.claim(ctx); err != nil || job != nil {
+		t.Errorf("second claim = %v, %v; want nil", job, err)
+	}
+}
+
+func TestClaimSkipsLockedRows(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	first := enqueue(t, db, "test.skip_locked")
+	second := enqueue(t, db, "test.skip_locked")
+	if _, err := db.Exec(ctx, `UPDATE jobs SET run_at = now() - INTERVAL '1 minute' WHERE id = $1`, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another worker is part way through claiming the first job
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SELECT id FROM jobs WHERE id = $1 FOR UPDATE`, first); err != nil {
+		t.Fatal(err)
+	}
+
+	claimCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	job, err := q.claim(claimCtx)
+	if err != nil {
+		t.Fatalf("claim blocked or failed instead of skipping the locked row: %v", err)
+	}
+	if job == nil || job.ID != second {
+		t.Errorf("claim = %+v, want the unlocked job %s", job, second)
+	}
+}
+
+func TestClaimReclaimsStaleLock(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	id := enqueue(t, db, "test.stale")
+	_, err := db.Exec(
+		ctx,
+		`UPDATE jobs SET status = 'running', attempts = 1, locked_at = now() - $2::FLOAT8 * INTERVAL '1 second'
+		WHERE id = $1`,
+		id,
+		(lockTimeout + time.Minute).Seconds(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != id || job.Attempts != 2 {
+		t.Fatalf("claim = %+v, want stale job %s on attempt 2", job, id)
+	}
+}
+
+func TestProcessOutcomes(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name        string
+		maxAttempts int
+		handlerErr  error
+		wantStatus  Status
+		wantError   string
+		wantDelayed bool
+	}{
+		{name: "done", maxAttempts: 5, wantStatus: StatusDone},
+		{name: "retry", maxAttempts: 5, handlerErr: errFailed, wantStatus: StatusPending, wantError: "failed", wantDelayed: true},
+		{name: "dead", maxAttempts: 1, handlerErr: errFailed, wantStatus: StatusDead, wantError: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, db := newTestQueue(t)
+			ctx := context.Background()
+			kind := "test.process." + tt.name
+			q.Handle(kind, func(context.Context, *Job) error { return tt.handlerErr })
+			id := enqueue(t, db, kind)
+			if _, err := db.Exec(ctx, `UPDATE jobs SET max_attempts = $2 WHERE id = $1`, id, tt.maxAttempts); err != nil {
+				t.Fatal(err)
+			}
+
+			job, err := q.claim(ctx)
+			if err != nil || job == nil {
+				t.Fatalf("claim = %v, %v", job, err)
+			}
+			q.process(ctx, job)
+
+			got := getJob(t, db, id)
+			if got.Status != tt.wantStatus || got.LastError != tt.wantError {
+				t.Errorf("job is %s with error %q, want %s with %q", got.Status, got.LastError, tt.wantStatus, tt.wantError)
+			}
+			if delayed := got.RunAt.After(time.Now().Add(minBackoff / 2)); delayed != tt.wantDelayed {
+				t.Errorf("run_at %s delayed = %v, want %v", got.RunAt, delayed, tt.wantDelayed)
+			}
+		})
+	}
+}
+
+func TestProcessPanicRetries(t *testing.T) {
+	q, db := newTestQueue(t)
+	q.Handle("test.panic", func(context.Context, *Job) error { panic("boom") })
+	id := enqueue(t, db, "test.panic")
+	job, err := q.claim(context.Background())
+	if err != nil || job == nil {
+		t.Fatalf("claim = %v, %v", job, err)
+	}
+	q.process(context.Background(), job)
+	if got := getJob(t, db, id); got.Status != StatusPending {
+		t.Errorf("panicking job is %s, want %s", got.Status, StatusPending)
+	}
+}
+
+func TestFinishAfterReclaim(t *testing.T) {
+	q, db := newTestQueue(t)
+	ctx := context.Background()
+	id := enqueue(t, db, "test.reclaimed")
+	stale, err := q.claim(ctx)
+	if err != nil || stale == nil {
+		t.Fatalf("claim = %v, %v", stale, err)
+	}
+	// The lock expires and another worker claims the job again
+	if _, err := db.Exec(ctx, `UPDATE jobs SET locked_at = now() - INTERVAL '1 day' WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	current, err := q.claim(ctx)
+	if err != nil || current == nil || current.Attempts != 2 {
+		t.Fatalf("reclaim = %+v, %v; want attempt 2", current, err)
+	}
+
+	ok, err := q.setOutcome(ctx, stale, StatusDead, 0, "too slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("stale worker overwrote the job")
+	}
+	if got := getJob(t, db, id); got.Status != StatusRunning || got.LastError != "" {
+		t.Errorf("job is %s with error %q, want still running", got.Status, got.LastError)
+	}
+
+	ok, err = q.setOutcome(ctx, current, StatusDone, 0, "")
+	if err != nil || !ok {
+		t.Fatalf("current worker's outcome = %v, %v; want written", ok, err)
+	}
+	if got := getJob(t, db, id); got.Status != StatusDone {
+		t.Errorf("job is %s, want %s", got.Status, StatusDone)
+	}
+}
@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/schedule"
+)
+
+// finishedRetention is how long completed jobs stay around for debugging
+const finishedRetention = 7 * 24 * time.Hour
+
+// RegisterTasks registers the queue's own housekeeping tasks.
+func RegisterTasks(s *schedule.Scheduler, db *database.DB) {
+	s.Register("jobs.purge_finished", "0 3 * * *", func(ctx context.Context) error {
+		n, err := PurgeFinished(ctx, db, finishedRetention)
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "purged finished jobs", "count", n)
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package lifestage
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+// Precision is how much of a birth date is known.
+type Precision string
+
+const (
+	PrecisionExact Precision = "exact"
+	PrecisionMonth Precision = "month"
+	PrecisionYear  Precision = "year"
+	// PrecisionEstimated is a best guess at the year, such as a vet's
+	// estimate from the teeth
+	PrecisionEstimated Precision = "estimated"
+	PrecisionUnknown   Precision = "unknown"
+)
+
+// Precisions lists every Precision, in the order a form should offer them.
+var Precisions = []Precision{PrecisionExact, PrecisionMonth, PrecisionYear, PrecisionEstimated, PrecisionUnknown}
+
+func (p Precision) IsValid() bool {
+	return slices.Contains(Precisions, p)
+}
+
+func (p Precision) Label() string {
+	switch p {
+	case PrecisionExact:
+		return "Exact date"
+	case PrecisionMonth:
+		return "Month and year"
+	case PrecisionYear:
+		return "Year only"
+	case PrecisionEstimated:
+		return "Estimated year"
+	case PrecisionUnknown:
+		return "Unknown"
+	}
+	return string(p)
+}
+
+// BirthDate is a birth date known to some precision. Date is the first day
+// of the known period: the day, the first of the month, or January 1.
+type BirthDate struct {
+	Date      time.Time
+	Precision Precision
+}
+
+var ErrInvalidBirthDate = errors.New("birth date must be YYYY-MM-DD, YYYY-MM or YYYY to match its precision")
+
+// ParseBirthDate reads a birth date written to its precision: "2015-03-04"
+// when exact, "2015-03" to the month, and "2015" for a known or estimated
+// year. An exact date may also be given for a coarser precision and is
+// truncated. The date is ignored for an unknown birth date.
+func ParseBirthDate(s string, p Precision) (BirthDate, error) {
+	if !p.IsValid() {
+		return BirthDate{}, ErrInvalidBirthDate
+	}
+	if p == PrecisionUnknown {
+		return BirthDate{Precision: p}, nil
+	}
+	var t time.Time
+	var err error
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err = time.Parse(layout, s); err == nil {
+			// A coarser layout than the precision needs leaves it unknown
+			if layout != "2006-01-02" && p == PrecisionExact || layout == "2006" && p == PrecisionMonth {
+				return BirthDate{}, ErrInvalidBirthDate
+			}
+			break
+		}
+	}
+	if err != nil || t.After(time.Now()) {
+		return BirthDate{}, ErrInvalidBirthDate
+	}
+	switch p {
+	case PrecisionMonth:
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case PrecisionYear, PrecisionEstimated:
+		t = time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return BirthDate{Date: t, Precision: p}, nil
+}
+
+func (b BirthDate) IsKnown() bool {
+	return b.Precision != PrecisionUnknown && !b.Date.IsZero()
+}
+
+// IsApproximate reports whether only the year of birth is known, so ages
+// are given in whole years and marked as approximate.
+func (b BirthDate) IsApproximate() bool {
+	return b.Precision == PrecisionYear || b.Precision == PrecisionEstimated
+}
+
+// Midpoint is the middle of the known period, the fairest single date to
+// work out an age from or sort by.
+func (b BirthDate) Midpoint() time.Time {
+	switch b.Precision {
+	case PrecisionMonth:
+		return b.Date.AddDate(0, 0, 14)
+	case PrecisionYear, PrecisionEstimated:
+		return time.Date(b.Date.Year(), time.July, 1, 0, 0, 0, 0, b.Date.Location())
+	}
+	return b.Date
+}
+
+// Input writes the date as a form would take it back.
+func (b BirthDate) Input() string {
+	switch {
+	case !b.IsKnown():
+		return ""
+	case b.Precision == PrecisionMonth:
+		return b.Date.Format("2006-01")
+	case b.IsApproximate():
+		return b.Date.Format("2006")
+	}
+	return b.Date.Format("2006-01-02")
+}
+
+// String writes the date as far as it is known, such as "4 March 2015",
+// "March 2015", "2015" or "approx. 2015".
+func (b BirthDate) String() string {
+	if !b.IsKnown() {
+		return "Unknown"
+	}
+	switch b.Precision {
+	case PrecisionMonth:
+		return b.Date.Format("January 2006")
+	case PrecisionYear:
+		return b.Date.Format("2006")
+	case PrecisionEstimated:
+		return "approx. " + b.Date.Format("2006")
+	}
+	return b.Date.Format("2 January 2006")
+}
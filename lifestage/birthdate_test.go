@@ -0,0 +1,43 @@
+package lifestage
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseBirthDate(t *testing.T) {
+	tests := []struct {
+		input     string
+		precision Precision
+		want      BirthDate
+		wantErr   bool
+	}{
+		{"2015-03-04", PrecisionExact, BirthDate{date(2015, time.March, 4), PrecisionExact}, false},
+		{"2015-03", PrecisionExact, BirthDate{}, true},
+		{"2015-03", PrecisionMonth, BirthDate{date(2015, time.March, 1), PrecisionMonth}, false},
+		{"2015-03-04", PrecisionMonth, BirthDate{date(2015, time.March, 1), PrecisionMonth}, false},
+		{"2015", PrecisionMonth, BirthDate{}, true},
+		{"2015", PrecisionYear, BirthDate{date(2015, time.January, 1), PrecisionYear}, false},
+		{"2015-03-04", PrecisionYear, BirthDate{date(2015, time.January, 1), PrecisionYear}, false},
+		{"2015", PrecisionEstimated, BirthDate{date(2015, time.January, 1), PrecisionEstimated}, false},
+		{"", PrecisionUnknown, BirthDate{Precision: PrecisionUnknown}, false},
+		{"2015", Precision("roughly"), BirthDate{}, true},
+		{"04/03/2015", PrecisionExact, BirthDate{}, true},
+		{"2999-01-01", PrecisionExact, BirthDate{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.precision)+" "+tt.input, func(t *testing.T) {
+			got, err := ParseBirthDate(tt.input, tt.precision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBirthDate(%q, %s) error = %v, wantErr %v", tt.input, tt.precision, err, tt.wantErr)
+			}
+			if !got.Date.Equal(tt.want.Date) || got.Precision != tt.want.Precision {
+				t.Errorf("ParseBirthDate(%q, %s) = %+v, want %+v", tt.input, tt.precision, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package lifestage works out horses' ages and life stages, by the calendar
+// or by the breed registry convention that every horse turns a year older
+// on January 1.
+package lifestage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Rules are a farm's conventions for ageing its horses.
+type Rules struct {
+	// RegistryAging counts a horse's years from January 1 of its birth
+	// year rather than from its birthday
+	RegistryAging bool `db:"registry_aging"`
+	// WeaningMonths is the age at which a foal becomes a weanling
+	WeaningMonths int `db:"weaning_months"`
+	// MatureAge is the age in years at which a colt or filly is counted a
+	// stallion, gelding or mare
+	MatureAge int `db:"mature_age"`
+}
+
+var DefaultRules = Rules{WeaningMonths: 6, MatureAge: 4}
+
+var ErrInvalidRules = errors.New("weaning must be between 3 and 11 months and maturity between 2 and 7 years")
+
+func (r Rules) Validate() error {
+	if r.WeaningMonths < 3 || r.WeaningMonths > 11 || r.MatureAge < 2 || r.MatureAge > 7 {
+		return ErrInvalidRules
+	}
+	return nil
+}
+
+// Age is a horse's age. Under registry ageing, and when only the year of
+// birth is known, Months is only counted in the horse's first year.
+type Age struct {
+	Years  int
+	Months int
+	// Approximate ages come from an estimated year of birth, or a known
+	// year counted by the calendar
+	Approximate bool
+	Unknown     bool
+}
+
+func (a Age) String() string {
+	if a.Unknown {
+		return "Unknown age"
+	}
+	if a.Approximate {
+		return "approx. " + Age{Years: a.Years, Months: a.Months}.String()
+	}
+	switch {
+	case a.Years == 0 && a.Months == 0:
+		return "under 1 month"
+	case a.Years == 0 && a.Months == 1:
+		return "1 month"
+	case a.Years == 0:
+		return fmt.Sprintf("%d months", a.Months)
+	}
+	years := fmt.Sprintf("%d years", a.Years)
+	if a.Years == 1 {
+		years = "1 year"
+	}
+	switch a.Months {
+	case 0:
+		return years
+	case 1:
+		return years + ", 1 month"
+	}
+	return fmt.Sprintf("%s, %d months", years, a.Months)
+}
+
+// calendarAge counts the whole years and months since birth. A horse born
+// on the 31st or on February 29 has its monthly birthday at the end of
+// shorter months.
+func calendarAge(birth, now time.Time) Age {
+	months := (now.Year()-birth.Year())*12 + int(now.Month()-birth.Month())
+	if now.Day() < birth.Day() && now.Day() != daysIn(now) {
+		months--
+	}
+	if months < 0 {
+		return Age{}
+	}
+	return Age{Years: months / 12, Months: months % 12}
+}
+
+func daysIn(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// AgeAt returns the age on now of a horse born on birth. When only the
+// month or year is known the age is counted from its middle. Ages in whole
+// years still give a foal in its first year its age in months.
+func (r Rules) AgeAt(birth BirthDate, now time.Time) Age {
+	var age Age
+	switch {
+	case !birth.IsKnown():
+		return Age{Unknown: true}
+	case r.RegistryAging:
+		// The year is all registry ageing needs
+		age = Age{Years: max(now.Year()-birth.Date.Year(), 0), Approximate: birth.Precision == PrecisionEstimated}
+	case birth.IsApproximate():
+		age = Age{Years: calendarAge(birth.Midpoint(), now).Years, Approximate: true}
+	default:
+		return calendarAge(birth.Midpoint(), now)
+	}
+	if age.Years == 0 {
+		age.Months = firstYearMonths(birth, now)
+	}
+	return age
+}
+
+// firstYearMonths is the calendar age in months of a horse in its first
+// year. A midpoint still to come, such as July 1 for a foal known only to
+// be born this year, is moved to halfway between the start of the known
+// period and now.
+func firstYearMonths(birth BirthDate, now time.Time) int {
+	from := birth.Midpoint()
+	if from.After(now) {
+		from = birth.Date.Add(now.Sub(birth.Date) / 2)
+	}
+	return calendarAge(from, now).Months
+}
+
+// IsYouth reports whether the horse is still a colt or filly on now. A
+// horse of unknown age is taken to be an adult.
+func (r Rules) IsYouth(birth BirthDate, now time.Time) bool {
+	age := r.AgeAt(birth, now)
+	return !age.Unknown && age.Years < r.MatureAge
+}
+
+type Stage string
+
+const (
+	StageFoal     Stage = "Foal"
+	StageWeanling Stage = "Weanling"
+	StageYearling Stage = "Yearling"
+	StageAdult    Stage = "Adult"
+	StageUnknown  Stage = "Unknown age"
+)
+
+// StageAt returns the life stage on now of a horse born on birth: foal,
+// weanling, yearling, then "2-year-old" and so on until it is an adult.
+// Weaning goes by the calendar even under registry ageing, which only
+// decides when the horse becomes a yearling and older.
+func (r Rules) StageAt(birth BirthDate, now time.Time) Stage {
+	age := r.AgeAt(birth, now)
+	years := age.Years
+	switch {
+	case age.Unknown:
+		return StageUnknown
+	case years >= r.MatureAge:
+		return StageAdult
+	case years == 0 && firstYearMonths(birth, now) < r.WeaningMonths:
+		return StageFoal
+	case years == 0:
+		return StageWeanling
+	case years == 1:
+		return StageYearling
+	}
+	return Stage(fmt.Sprintf("%d-year-old", years))
+}
+
+// Stages lists the stages under r in order, for reports, ending with
+// StageUnknown.
+func (r Rules) Stages() []Stage {
+	stages := []Stage{StageFoal, StageWeanling}
+	if r.MatureAge > 1 {
+		stages = append(stages, StageYearling)
+	}
+	for years := 2; years < r.MatureAge; years++ {
+		stages = append(stages, Stage(fmt.Sprintf("%d-year-old", years)))
+	}
+	return append(stages, StageAdult, StageUnknown)
+}
@@ -0,0 +1,79 @@
+package lifestage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarAge(t *testing.T) {
+	tests := []struct {
+		name       string
+		birth, now time.Time
+		want       Age
+	}{
+		{"day before birthday", date(2020, time.March, 15), date(2021, time.March, 14), Age{Years: 0, Months: 11}},
+		{"on birthday", date(2020, time.March, 15), date(2021, time.March, 15), Age{Years: 1}},
+		{"31st at end of short month", date(2020, time.January, 31), date(2020, time.April, 30), Age{Months: 3}},
+		{"31st before end of month", date(2020, time.January, 31), date(2020, time.March, 30), Age{Months: 1}},
+		{"31st at end of leap February", date(2020, time.January, 31), date(2020, time.February, 29), Age{Months: 1}},
+		{"31st before end of leap February", date(2020, time.January, 31), date(2020, time.February, 28), Age{}},
+		{"February 29 in common year", date(2020, time.February, 29), date(2021, time.February, 28), Age{Years: 1}},
+		{"February 29 day before", date(2020, time.February, 29), date(2021, time.February, 27), Age{Months: 11}},
+		{"February 29 in leap year", date(2020, time.February, 29), date(2024, time.February, 29), Age{Years: 4}},
+		{"born after now", date(2021, time.May, 1), date(2021, time.April, 1), Age{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendarAge(tt.birth, tt.now); got != tt.want {
+				t.Errorf("calendarAge(%s, %s) = %+v, want %+v", tt.birth.Format(time.DateOnly), tt.now.Format(time.DateOnly), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeAt(t *testing.T) {
+	registry := Rules{RegistryAging: true, WeaningMonths: 6, MatureAge: 4}
+	calendar := Rules{WeaningMonths: 6, MatureAge: 4}
+	tests := []struct {
+		name  string
+		rules Rules
+		birth BirthDate
+		now   time.Time
+		want  Age
+	}{
+		{"registry foal", registry, BirthDate{date(2025, time.March, 10), PrecisionExact}, date(2025, time.June, 20), Age{Months: 3}},
+		{"registry after January 1", registry, BirthDate{date(2024, time.December, 1), PrecisionExact}, date(2025, time.January, 5), Age{Years: 1}},
+		{"registry estimated", registry, BirthDate{date(2018, time.January, 1), PrecisionEstimated}, date(2025, time.June, 1), Age{Years: 7, Approximate: true}},
+		{"year known foal", calendar, BirthDate{date(2025, time.January, 1), PrecisionYear}, date(2025, time.October, 15), Age{Months: 3, Approximate: true}},
+		{"year known foal before midpoint", calendar, BirthDate{date(2025, time.January, 1), PrecisionYear}, date(2025, time.March, 1), Age{Months: 1, Approximate: true}},
+		{"year known adult", calendar, BirthDate{date(2015, time.January, 1), PrecisionYear}, date(2025, time.October, 15), Age{Years: 10, Approximate: true}},
+		{"month known", calendar, BirthDate{date(2024, time.May, 1), PrecisionMonth}, date(2025, time.July, 20), Age{Years: 1, Months: 2}},
+		{"unknown", calendar, BirthDate{Precision: PrecisionUnknown}, date(2025, time.July, 20), Age{Unknown: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.AgeAt(tt.birth, tt.now); got != tt.want {
+				t.Errorf("AgeAt = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeString(t *testing.T) {
+	tests := []struct {
+		age  Age
+		want string
+	}{
+		{Age{}, "under 1 month"},
+		{Age{Months: 1}, "1 month"},
+		{Age{Months: 3, Approximate: true}, "approx. 3 months"},
+		{Age{Years: 1}, "1 year"},
+		{Age{Years: 2, Months: 1}, "2 years, 1 month"},
+		{Age{Unknown: true}, "Unknown age"},
+	}
+	for _, tt := range tests {
+		if got := tt.age.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.age, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/DevonFarm/sales/config"
+)
+
+const loggerKey = "logger"
+
+// Setup installs the default slog logger: JSON lines for production, or
+// human readable text when configured for local development.
+func Setup(cfg config.LogConfig) *slog.Logger {
+	var level slog.Level
+	// Already validated by the config package
+	_ = level.UnmarshalText([]byte(cfg.Level))
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Middleware must be mounted after the requestid middleware. It gives each
+// request a logger carrying the request ID and writes one access log line
+// once the request has been handled.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		requestID, _ := c.Locals("requestid").(string)
+		logger := slog.Default().With("request_id", requestID)
+		if sc := trace.SpanContextFromContext(c.UserContext()); sc.HasTraceID() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		c.Locals(loggerKey, logger)
+
+		err := c.Next()
+		if err != nil {
+			// Run the error handler now so the access log has the real status
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		}
+		var fiberErr *fiber.Error
+		if err != nil && !errors.As(err, &fiberErr) {
+			attrs = append(attrs, "error", err.Error())
+		}
+		From(c).Log(c.UserContext(), level, "request", attrs...)
+		return nil
+	}
+}
+
+// From returns the request's logger, or the default logger outside of the
+// logging middleware.
+func From(c *fiber.Ctx) *slog.Logger {
+	if logger, ok := c.Locals(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With attaches attributes, such as the authenticated user and farm, to
+// every later log line of the request.
+func With(c *fiber.Ctx, args ...any) {
+	c.Locals(loggerKey, From(c).With(args...))
+}
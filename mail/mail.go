@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/DevonFarm/sales/config"
+)
+
+// Mailer sends plain text email over SMTP. It should only be used from
+// background jobs so that a slow mail server never holds up a request.
+type Mailer struct {
+	cfg config.MailConfig
+}
+
+func New(cfg config.MailConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers a message to a single recipient. When mail is not configured
+// the message is logged and dropped, which keeps local development working.
+func (m *Mailer) Send(ctx context.Context, to, subject, body string) error {
+	if !m.cfg.Enabled() {
+		slog.InfoContext(ctx, "mail disabled, not sending", "to", to, "subject", subject)
+		return nil
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	if err := m.deliver(ctx, to, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", to, err)
+	}
+	return nil
+}
+
+// sendTimeout bounds a send when ctx has no deadline of its own.
+const sendTimeout = 30 * time.Second
+
+// deliver does what smtp.SendMail does, but gives up when ctx is done so a
+// stalled mail server can't hold a job worker forever.
+func (m *Mailer) deliver(ctx context.Context, to string, msg []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sendTimeout)
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// Cancelling ctx early unblocks any read or write in progress
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.cfg.SMTPHost)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.cfg.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"log"
+	"os"
+	"time"
 
+	"github.com/DevonFarm/sales/account"
+	"github.com/DevonFarm/sales/admin"
+	"github.com/DevonFarm/sales/config"
 	"github.com/DevonFarm/sales/farm"
 	"github.com/DevonFarm/sales/horse"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/logging"
 	"github.com/DevonFarm/sales/server"
+	"github.com/DevonFarm/sales/tracing"
 	"github.com/DevonFarm/sales/user"
 )
 
@@ -14,16 +23,46 @@ import (
 var templates embed.FS
 
 func runServer() error {
-	srvr, err := server.NewServer(templates)
+	// CONFIG_FILE optionally points at a YAML or TOML file; the environment
+	// and .env still override anything set there
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
 	if err != nil {
 		return err
 	}
+	logging.Setup(cfg.Log)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Flush spans still buffered when the server stops
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("failed to flush traces: %v", err)
+		}
+	}()
 
-	horse.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth)
+	srvr, err := server.NewServer(templates, cfg)
+	if err != nil {
+		return err
+	}
+
+	horse.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth, srvr.Storage)
 	farm.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth)
-	user.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth.RequireAuth())
+	user.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth.RequireAuth(), srvr.Auth.RequireUser(srvr.DB))
+	account.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth)
+	admin.RegisterRoutes(srvr.App, srvr.DB, srvr.Auth)
+
+	horse.RegisterJobs(srvr.Jobs, srvr.DB, srvr.Mail, srvr.Storage)
+	farm.RegisterJobs(srvr.Jobs, srvr.DB, srvr.Mail)
+	user.RegisterJobs(srvr.Jobs, srvr.DB, srvr.Mail)
+	account.RegisterJobs(srvr.Jobs, srvr.Auth)
+
+	jobs.RegisterTasks(srvr.Schedule, srvr.DB)
+	farm.RegisterTasks(srvr.Schedule, srvr.DB)
 
-	return srvr.Listen(":4242")
+	return srvr.Run()
 }
 
 func main() {
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/DevonFarm/sales/database"
+)
+
+const namespace = "devonfarm"
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by query name.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"query"})
+
+	stytchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stytch_request_duration_seconds",
+		Help:      "Latency of calls to the Stytch API by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	stytchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stytch_request_errors_total",
+		Help:      "Failed calls to the Stytch API by operation.",
+	}, []string{"operation"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Background job run time by kind and outcome.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"kind", "outcome"})
+
+	// Business counters
+	HorsesCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "horses_created_total",
+		Help:      "Horses added to a farm.",
+	})
+	FarmsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "farms_created_total",
+		Help:      "Farms created.",
+	})
+	UsersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_created_total",
+		Help:      "Users created on first login.",
+	})
+	ListingsSold = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "listings_sold_total",
+		Help:      "Horses marked as sold.",
+	})
+)
+
+// Middleware records the latency of every request. It must be mounted
+// outside the logging middleware so that the error handler has already set
+// the final status.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+		route := c.Route().Path
+		if c.Response().StatusCode() == fiber.StatusNotFound {
+			// Keep unknown paths from creating a series each
+			route = "unmatched"
+		}
+		httpDuration.WithLabelValues(
+			c.Method(),
+			route,
+			strconv.Itoa(c.Response().StatusCode()),
+		).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// TimeQuery starts timing the named query. Call the returned function when
+// the query is done, typically with defer:
+//
+//	defer metrics.TimeQuery("horse.GetHorsesByFarmID")()
+func TimeQuery(name string) func() {
+	start := time.Now()
+	return func() {
+		queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveStytch records a call to the Stytch API that started at start and
+// finished with err.
+func ObserveStytch(operation string, start time.Time, err error) {
+	stytchDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		stytchErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveJob records one attempt of a background job. outcome is "done",
+// "retry" or "dead".
+func ObserveJob(kind, outcome string, start time.Time) {
+	jobDuration.WithLabelValues(kind, outcome).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDBStats exposes the connection pool statistics of db.
+func RegisterDBStats(db *database.DB) {
+	prometheus.MustRegister(&poolCollector{db: db})
+}
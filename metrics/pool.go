@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/DevonFarm/sales/database"
+)
+
+var (
+	poolAcquiredConns = prometheus.NewDesc(
+		namespace+"_db_pool_acquired_conns", "Connections currently in use.", nil, nil)
+	poolIdleConns = prometheus.NewDesc(
+		namespace+"_db_pool_idle_conns", "Idle connections in the pool.", nil, nil)
+	poolTotalConns = prometheus.NewDesc(
+		namespace+"_db_pool_total_conns", "Total connections in the pool.", nil, nil)
+	poolMaxConns = prometheus.NewDesc(
+		namespace+"_db_pool_max_conns", "Maximum size of the pool.", nil, nil)
+	poolAcquireCount = prometheus.NewDesc(
+		namespace+"_db_pool_acquires_total", "Successful connection acquisitions.", nil, nil)
+	poolEmptyAcquireCount = prometheus.NewDesc(
+		namespace+"_db_pool_empty_acquires_total", "Acquisitions that had to wait for a connection.", nil, nil)
+	poolAcquireDuration = prometheus.NewDesc(
+		namespace+"_db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.", nil, nil)
+)
+
+// poolCollector reads pgxpool statistics at scrape time.
+type poolCollector struct {
+	db *database.DB
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquiredConns
+	ch <- poolIdleConns
+	ch <- poolTotalConns
+	ch <- poolMaxConns
+	ch <- poolAcquireCount
+	ch <- poolEmptyAcquireCount
+	ch <- poolAcquireDuration
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := p.db.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
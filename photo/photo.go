@@ -0,0 +1,175 @@
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+
+	"github.com/disintegration/imaging"
+	"github.com/gen2brain/webp"
+)
+
+const (
+	// maxPixels rejects images that would take too much memory to decode
+	maxPixels = 60_000_000
+
+	jpegQuality = 82
+	webpQuality = 78
+	// originalQuality is used for the full size copy kept for staff, which
+	// later variants may be regenerated from
+	originalQuality = 92
+)
+
+// Widths are the sizes, in pixels, that variants are generated at.
+var Widths = []int{320, 640, 1024, 1600}
+
+var ErrTooLarge = errors.New("image is too large")
+
+// Decode reads an uploaded photo and rotates it upright according to its
+// EXIF orientation. Nothing else of the EXIF data survives, so images
+// encoded from the result carry no camera metadata or GPS position.
+func Decode(r io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind image: %w", err)
+	}
+	img, err := imaging.Decode(r, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+// VariantWidths returns the entries of Widths that are narrower than an
+// image of the given width, plus the width itself when it falls between
+// two sizes, so that small photos are never scaled up.
+func VariantWidths(width int) []int {
+	var widths []int
+	for _, w := range Widths {
+		if w >= width {
+			widths = append(widths, width)
+			return widths
+		}
+		widths = append(widths, w)
+	}
+	return widths
+}
+
+// Resize scales img to width, keeping its aspect ratio.
+func Resize(img image.Image, width int) image.Image {
+	if img.Bounds().Dx() == width {
+		return img
+	}
+	return imaging.Resize(img, width, 0, imaging.Lanczos)
+}
+
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	return encodeJPEG(img, jpegQuality)
+}
+
+func EncodeOriginal(img image.Image) ([]byte, error) {
+	return encodeJPEG(img, originalQuality)
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func EncodeWebP(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, img, webp.Options{Quality: webpQuality, Method: webp.DefaultMethod}); err != nil {
+		return nil, fmt.Errorf("failed to encode webp: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Position is where on a photo a watermark is placed.
+type Position string
+
+const (
+	TopLeft     Position = "top_left"
+	TopRight    Position = "top_right"
+	BottomLeft  Position = "bottom_left"
+	BottomRight Position = "bottom_right"
+	Center      Position = "center"
+)
+
+// Positions lists every Position, in the order a form should offer them.
+var Positions = []Position{TopLeft, TopRight, Center, BottomLeft, BottomRight}
+
+func (p Position) IsValid() bool {
+	return slices.Contains(Positions, p)
+}
+
+// Label is the position as shown to users.
+func (p Position) Label() string {
+	switch p {
+	case TopLeft:
+		return "Top left"
+	case TopRight:
+		return "Top right"
+	case BottomLeft:
+		return "Bottom left"
+	case BottomRight:
+		return "Bottom right"
+	case Center:
+		return "Centre"
+	}
+	return string(p)
+}
+
+const (
+	// watermarkScale is the width of a watermark relative to the photo
+	watermarkScale = 0.2
+	// watermarkMargin is the gap to the photo's edges relative to its width
+	watermarkMargin = 0.03
+)
+
+// Watermark returns a copy of img with logo drawn over it at pos. The logo
+// is scaled to a fifth of the photo's width and blended at opacity, from
+// 0 to 1, so a watermark looks the same on every variant.
+func Watermark(img, logo image.Image, pos Position, opacity float64) image.Image {
+	b := img.Bounds()
+	w := max(int(float64(b.Dx())*watermarkScale), 1)
+	mark := imaging.Resize(logo, w, 0, imaging.Lanczos)
+	margin := int(float64(b.Dx()) * watermarkMargin)
+
+	x := b.Dx() - mark.Bounds().Dx() - margin
+	y := b.Dy() - mark.Bounds().Dy() - margin
+	switch pos {
+	case TopLeft:
+		x, y = margin, margin
+	case TopRight:
+		y = margin
+	case BottomLeft:
+		x = margin
+	case Center:
+		x = (b.Dx() - mark.Bounds().Dx()) / 2
+		y = (b.Dy() - mark.Bounds().Dy()) / 2
+	}
+	return imaging.Overlay(img, mark, image.Pt(x, y), opacity)
+}
+
+// EncodePNG is used for logos, which need to keep their transparency.
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+type TaskStatus struct {
+	Name          string     `db:"name"`
+	Schedule      string     `db:"schedule"`
+	NextRunAt     time.Time  `db:"next_run_at"`
+	LockedBy      *string    `db:"locked_by"`
+	LastRunAt     *time.Time `db:"last_run_at"`
+	LastSuccessAt *time.Time `db:"last_success_at"`
+	LastError     string     `db:"last_error"`
+}
+
+// Running reports whether an instance currently holds the task's lease.
+func (t *TaskStatus) Running() bool {
+	return t.LockedBy != nil
+}
+
+type Run struct {
+	ID         uuid.UUID `db:"id"`
+	Task       string    `db:"task"`
+	Instance   string    `db:"instance"`
+	StartedAt  time.Time `db:"started_at"`
+	FinishedAt time.Time `db:"finished_at"`
+	Error      string    `db:"error"`
+}
+
+func (r *Run) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond)
+}
+
+func GetTaskStatuses(ctx context.Context, db *database.DB) ([]*TaskStatus, error) {
+	defer metrics.TimeQuery("schedule.GetTaskStatuses")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT name, schedule, next_run_at, locked_by, last_run_at, last_success_at, last_error
+		FROM scheduled_tasks ORDER BY name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scheduled tasks: %w", err)
+	}
+	tasks, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[TaskStatus])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect scheduled tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+// GetRecentRuns returns the latest runs of all tasks, newest first.
+func GetRecentRuns(ctx context.Context, db *database.DB, limit int) ([]*Run, error) {
+	defer metrics.TimeQuery("schedule.GetRecentRuns")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT id, task, instance, started_at, finished_at, error
+		FROM task_runs ORDER BY started_at DESC LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task runs: %w", err)
+	}
+	runs, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[Run])
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect task runs: %w", err)
+	}
+	return runs, nil
+}
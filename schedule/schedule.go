@@ -0,0 +1,237 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/robfig/cron/v3"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
+)
+
+const (
+	// tickInterval is how often the scheduler looks for due tasks, and so
+	// the worst case delay before a task starts
+	tickInterval = 30 * time.Second
+	// taskTimeout bounds a single run of a task
+	taskTimeout = 15 * time.Minute
+	// leaseDuration outlasts taskTimeout so that a lease only runs out
+	// early if its instance died
+	leaseDuration = taskTimeout + time.Minute
+	// runRetention is how long run history is kept
+	runRetention = 30 * 24 * time.Hour
+)
+
+type task struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered tasks on cron schedules. It implements the
+// server's Worker interface; tasks must all be registered before it starts.
+type Scheduler struct {
+	db       *database.DB
+	instance string
+	tasks    []*task
+}
+
+func New(db *database.DB) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		db:       db,
+		instance: fmt.Sprintf("%s-%d", host, os.Getpid()),
+	}
+}
+
+// Register adds a task run on the standard five field cron spec, e.g.
+// "0 7 * * MON". Specs are evaluated in UTC unless prefixed with
+// CRON_TZ=<zone>. It panics on an invalid spec or a duplicate name.
+func (s *Scheduler) Register(name, spec string, run func(ctx context.Context) error) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		panic(fmt.Sprintf("schedule: invalid spec %q for %s: %v", spec, name, err))
+	}
+	for _, t := range s.tasks {
+		if t.name == name {
+			panic(fmt.Sprintf("schedule: task %q registered twice", name))
+		}
+	}
+	s.tasks = append(s.tasks, &task{name: name, spec: spec, schedule: sched, run: run})
+}
+
+func (s *Scheduler) Name() string {
+	return "scheduler"
+}
+
+// Run checks for due tasks every tickInterval until ctx is cancelled, then
+// waits for running tasks to return.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.sync(ctx); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		for _, t := range s.tasks {
+			leased, err := s.lease(ctx, t)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("failed to lease task", "task", t.name, "error", err)
+				}
+				continue
+			}
+			if leased {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.runTask(ctx, t)
+				}()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync records every registered task, rescheduling those whose spec changed
+// since the last deploy.
+func (s *Scheduler) sync(ctx context.Context) error {
+	for _, t := range s.tasks {
+		_, err := s.db.Exec(
+			ctx,
+			`INSERT INTO scheduled_tasks (name, schedule, next_run_at) VALUES ($1, $2, $3)
+			ON CONFLICT (name) DO UPDATE SET
+				schedule = excluded.schedule,
+				next_run_at = CASE WHEN scheduled_tasks.schedule = excluded.schedule
+					THEN scheduled_tasks.next_run_at ELSE excluded.next_run_at END,
+				updated_at = now()`,
+			t.name,                            // $1
+			t.spec,                            // $2
+			t.schedule.Next(time.Now()).UTC(), // $3
+		)
+		if err != nil {
+			return fmt.Errorf("failed to sync task %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// lease takes the task's lease if the task is due and no live lease is held.
+func (s *Scheduler) lease(ctx context.Context, t *task) (bool, error) {
+	defer metrics.TimeQuery("schedule.lease")()
+
+	tag, err := s.db.Exec(
+		ctx,
+		`UPDATE scheduled_tasks
+		SET locked_by = $2, locked_until = now() + $3::FLOAT8 * INTERVAL '1 second', updated_at = now()
+		WHERE name = $1 AND next_run_at <= now() AND (locked_until IS NULL OR locked_until < now())`,
+		t.name,                  // $1
+		s.instance,              // $2
+		leaseDuration.Seconds(), // $3
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to lease task: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Scheduler) runTask(ctx context.Context, t *task) {
+	logger := slog.With("task", t.name)
+	logger.Info("task started")
+	start := time.Now()
+
+	err := s.call(ctx, t)
+	var lastError string
+	if err != nil {
+		lastError = err.Error()
+		logger.Error("task failed", "error", err)
+	} else {
+		logger.Info("task finished", "duration_ms", time.Since(start).Milliseconds())
+	}
+
+	// Record the run even if we are shutting down
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := s.finish(finishCtx, t, start, lastError); err != nil {
+		logger.Error("failed to record task run", "error", err)
+	}
+}
+
+// call runs the task, turning a panic into an error.
+func (s *Scheduler) call(ctx context.Context, t *task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panicked: %v", r)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, taskTimeout)
+	defer cancel()
+	return t.run(ctx)
+}
+
+// finish releases the lease, schedules the next run and appends the run to
+// the task's history.
+func (s *Scheduler) finish(ctx context.Context, t *task, start time.Time, lastError string) error {
+	defer metrics.TimeQuery("schedule.finish")()
+
+	now := time.Now().UTC()
+	return pgx.BeginFunc(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(
+			ctx,
+			`UPDATE scheduled_tasks SET
+				next_run_at = $2,
+				locked_by = NULL,
+				locked_until = NULL,
+				last_run_at = $3,
+				last_success_at = CASE WHEN $4 = '' THEN $5 ELSE last_success_at END,
+				last_error = $4,
+				updated_at = now()
+			WHERE name = $1 AND locked_by = $6`,
+			t.name,                     // $1
+			t.schedule.Next(now).UTC(), // $2
+			start.UTC(),                // $3
+			lastError,                  // $4
+			now,                        // $5
+			s.instance,                 // $6
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update task: %w", err)
+		}
+		_, err = tx.Exec(
+			ctx,
+			`INSERT INTO task_runs (task, instance, started_at, finished_at, error) VALUES ($1, $2, $3, $4, $5)`,
+			t.name,      // $1
+			s.instance,  // $2
+			start.UTC(), // $3
+			now,         // $4
+			lastError,   // $5
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert task run: %w", err)
+		}
+		_, err = tx.Exec(
+			ctx,
+			`DELETE FROM task_runs WHERE task = $1 AND started_at < now() - $2::FLOAT8 * INTERVAL '1 second'`,
+			t.name,                 // $1
+			runRetention.Seconds(), // $2
+		)
+		if err != nil {
+			return fmt.Errorf("failed to prune task runs: %w", err)
+		}
+		return nil
+	})
+}
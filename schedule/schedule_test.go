@@ -0,0 +1,204 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/database/dbtest"
+)
+
+func nop(context.Context) error { return nil }
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(s *Scheduler)
+		want  string
+	}{
+		{
+			name:  "invalid spec",
+			setup: func(s *Scheduler) { s.Register("bad", "every monday", nop) },
+			want:  "invalid spec",
+		},
+		{
+			name: "duplicate name",
+			setup: func(s *Scheduler) {
+				s.Register("twice", "0 7 * * MON", nop)
+				s.Register("twice", "0 8 * * MON", nop)
+			},
+			want: "registered twice",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if msg, _ := r.(string); !strings.Contains(msg, tt.want) {
+					t.Errorf("panic = %v, want one mentioning %q", r, tt.want)
+				}
+			}()
+			tt.setup(New(nil))
+		})
+	}
+}
+
+func TestCallRecoversPanic(t *testing.T) {
+	s := New(nil)
+	s.Register("panics", "@hourly", func(context.Context) error { panic("boom") })
+	if err := s.call(context.Background(), s.tasks[0]); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("call = %v, want the panic as an error", err)
+	}
+}
+
+// newTestTask registers a uniquely named task on s and removes its rows
+// when the test ends.
+func newTestTask(t *testing.T, db *database.DB, s *Scheduler, spec string, run func(context.Context) error) *task {
+	t.Helper()
+	name := "test." + uuid.NewString()
+	s.Register(name, spec, run)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		db.Exec(ctx, `DELETE FROM scheduled_tasks WHERE name = $1`, name)
+		db.Exec(ctx, `DELETE FROM task_runs WHERE task = $1`, name)
+	})
+	return s.tasks[len(s.tasks)-1]
+}
+
+// makeDue brings the task's next run forward to now.
+func makeDue(t *testing.T, db *database.DB, name string) {
+	t.Helper()
+	if _, err := db.Exec(context.Background(), `UPDATE scheduled_tasks SET next_run_at = now() - INTERVAL '1 minute' WHERE name = $1`, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getStatus(t *testing.T, db *database.DB, name string) *TaskStatus {
+	t.Helper()
+	tasks, err := GetTaskStatuses(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ts := range tasks {
+		if ts.Name == name {
+			return ts
+		}
+	}
+	t.Fatalf("task %s not recorded", name)
+	return nil
+}
+
+func TestSyncReschedulesChangedSpec(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	s := New(db)
+	tk := newTestTask(t, db, s, "0 7 * * MON", nop)
+	if err := s.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	makeDue(t, db, tk.name)
+
+	// Same spec: the pending run is kept
+	if err := s.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ts := getStatus(t, db, tk.name); ts.NextRunAt.After(time.Now()) {
+		t.Errorf("next run moved to %s though the spec is unchanged", ts.NextRunAt)
+	}
+
+	// New spec: rescheduled from it
+	s2 := New(db)
+	s2.Register(tk.name, "0 8 * * TUE", nop)
+	if err := s2.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	ts := getStatus(t, db, tk.name)
+	if ts.Schedule != "0 8 * * TUE" || !ts.NextRunAt.After(time.Now()) {
+		t.Errorf("got schedule %q next run %s, want rescheduled from the new spec", ts.Schedule, ts.NextRunAt)
+	}
+}
+
+func TestLeaseIsExclusive(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	a := New(db)
+	a.instance = "instance-a"
+	tk := newTestTask(t, db, a, "@hourly", nop)
+	b := New(db)
+	b.instance = "instance-b"
+	b.Register(tk.name, "@hourly", nop)
+	if err := a.sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if leased, err := a.lease(ctx, tk); err != nil || leased {
+		t.Fatalf("lease before due = %v, %v; want false", leased, err)
+	}
+	makeDue(t, db, tk.name)
+	if leased, err := a.lease(ctx, tk); err != nil || !leased {
+		t.Fatalf("lease when due = %v, %v; want true", leased, err)
+	}
+	if leased, err := b.lease(ctx, b.tasks[0]); err != nil || leased {
+		t.Fatalf("second instance took a held lease: %v, %v", leased, err)
+	}
+
+	// A lease left behind by a dead instance runs out
+	if _, err := db.Exec(ctx, `UPDATE scheduled_tasks SET locked_until = now() - INTERVAL '1 second' WHERE name = $1`, tk.name); err != nil {
+		t.Fatal(err)
+	}
+	if leased, err := b.lease(ctx, b.tasks[0]); err != nil || !leased {
+		t.Fatalf("lease after expiry = %v, %v; want true", leased, err)
+	}
+	if ts := getStatus(t, db, tk.name); ts.LockedBy == nil || *ts.LockedBy != "instance-b" {
+		t.Errorf("locked by %v, want instance-b", ts.LockedBy)
+	}
+}
+
+func TestRunTaskRecordsRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr string
+	}{
+		{name: "success"},
+		{name: "failure", err: errors.New("smtp down"), wantErr: "smtp down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			ctx := context.Background()
+			s := New(db)
+			tk := newTestTask(t, db, s, "@hourly", func(context.Context) error { return tt.err })
+			if err := s.sync(ctx); err != nil {
+				t.Fatal(err)
+			}
+			makeDue(t, db, tk.name)
+			if leased, err := s.lease(ctx, tk); err != nil || !leased {
+				t.Fatalf("lease = %v, %v", leased, err)
+			}
+
+			s.runTask(ctx, tk)
+
+			ts := getStatus(t, db, tk.name)
+			if ts.Running() || !ts.NextRunAt.After(time.Now()) || ts.LastError != tt.wantErr {
+				t.Errorf("got running %v, next run %s, error %q; want released, rescheduled, %q",
+					ts.Running(), ts.NextRunAt, ts.LastError, tt.wantErr)
+			}
+			if succeeded := ts.LastSuccessAt != nil; succeeded != (tt.err == nil) {
+				t.Errorf("last success set = %v, want %v", succeeded, tt.err == nil)
+			}
+			var runs int
+			if err := db.QueryRow(ctx, `SELECT count(*) FROM task_runs WHERE task = $1 AND error = $2`, tk.name, tt.wantErr).Scan(&runs); err != nil {
+				t.Fatal(err)
+			}
+			if runs != 1 {
+				t.Errorf("recorded %d runs, want 1", runs)
+			}
+		})
+	}
+}
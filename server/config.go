@@ -4,33 +4,44 @@ import (
 	"embed"
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/filesystem"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/template/html/v2"
-	"github.com/joho/godotenv"
 
 	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/config"
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/health"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/logging"
+	"github.com/DevonFarm/sales/mail"
+	"github.com/DevonFarm/sales/metrics"
+	"github.com/DevonFarm/sales/schedule"
+	"github.com/DevonFarm/sales/storage"
+	"github.com/DevonFarm/sales/tracing"
 )
 
 type Server struct {
-	App  *fiber.App
-	DB   *database.DB
-	Auth *auth.StytchAuth
+	App    *fiber.App
+	DB     *database.DB
+	Auth   *auth.StytchAuth
+	Config *config.Config
+	// Jobs runs background jobs; register handlers on it before Run
+	Jobs *jobs.Queue
+	// Schedule runs recurring tasks; register them before Run
+	Schedule *schedule.Scheduler
+	Mail     *mail.Mailer
+	Storage  storage.Store
+
+	workers []Worker
 }
 
 // templateFS must contain the "templates" and "assets" directories and
 // "templates/layouts/main.html" must exist.
-func NewServer(templateFS embed.FS) (*Server, error) {
-	godotenv.Load()
-	connString := os.Getenv("COCKROACH_DSN")
-	if connString == "" {
-		return nil, fmt.Errorf("missing COCKROACH_DSN env var")
-	}
-	db, err := database.NewDBConn(connString)
+func NewServer(templateFS embed.FS, cfg *config.Config) (*Server, error) {
+	db, err := database.NewDBConn(cfg.DB.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to db: %w", err)
 	}
@@ -40,8 +51,38 @@ func NewServer(templateFS embed.FS) (*Server, error) {
 	app := fiber.New(fiber.Config{
 		Views:       engine,
 		ViewsLayout: "templates/layouts/main",
+		// Lets the layout see who is logged in and any active impersonation
+		PassLocalsToViews: true,
+		ErrorHandler:      errorHandler,
+		BodyLimit:         cfg.Storage.MaxUploadBytes,
+		// Only believe the proxy header on requests from a known proxy, and
+		// only take a well-formed address from it
+		ProxyHeader:             cfg.Proxy.Header,
+		EnableTrustedProxyCheck: len(cfg.Proxy.TrustedProxies) > 0,
+		TrustedProxies:          cfg.Proxy.TrustedProxies,
+		EnableIPValidation:      true,
 	})
-	app.Use(logger.New())
+	// Stytch and storage are needed by the readiness check, so create them
+	// up front
+	stytch, err := auth.NewStytch(cfg.Auth)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("stytch failed to configure: %w", err)
+	}
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("storage failed to configure: %w", err)
+	}
+
+	// Probes are mounted ahead of the middleware so they stay out of the
+	// access logs, traces and request metrics
+	health.RegisterRoutes(app, readinessChecks(db, stytch, store, cfg.Health)...)
+
+	app.Use(requestid.New())
+	app.Use(tracing.Middleware())
+	app.Use(metrics.Middleware())
+	app.Use(logging.Middleware())
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.Render("templates/index", fiber.Map{
 			"Title": "Devon Farm Sales",
@@ -49,11 +90,8 @@ func NewServer(templateFS embed.FS) (*Server, error) {
 	})
 
 	// Auth routes
-	stytch, err := auth.NewStytchFromEnv()
-	if err != nil {
-		return nil, fmt.Errorf("stytch failed to configure: %w", err)
-	}
 	stytch.Register(app, db)
+	storage.RegisterRoutes(app, store)
 
 	// Serve static assets from embedded filesystem
 	app.Use("/assets", filesystem.New(filesystem.Config{
@@ -61,13 +99,21 @@ func NewServer(templateFS embed.FS) (*Server, error) {
 		PathPrefix: "assets",
 	}))
 
-	return &Server{
-		App:  app,
-		DB:   db,
-		Auth: stytch,
-	}, nil
-}
-
-func (s *Server) Listen(addr string) error {
-	return s.App.Listen(addr)
+	srvr := &Server{
+		App:      app,
+		DB:       db,
+		Auth:     stytch,
+		Config:   cfg,
+		Jobs:     jobs.NewQueue(db, cfg.Jobs),
+		Schedule: schedule.New(db),
+		Mail:     mail.New(cfg.Mail),
+		Storage:  store,
+	}
+	srvr.AddWorker(srvr.Jobs)
+	srvr.AddWorker(srvr.Schedule)
+	metrics.RegisterDBStats(db)
+	if cfg.Metrics.Addr != "" {
+		srvr.AddWorker(newMetricsWorker(cfg.Metrics.Addr))
+	}
+	return srvr, nil
 }
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/logging"
+)
+
+// errorHandler answers every error a handler returns: with the error page
+// for browsers and with JSON for API clients. Both carry the request ID so
+// a report can be matched to the logs. The underlying error is logged by
+// the logging middleware's access line.
+func errorHandler(c *fiber.Ctx, err error) error {
+	appErr := apperr.As(err)
+	status := appErr.StatusCode()
+	requestID, _ := c.Locals("requestid").(string)
+
+	c.Status(status)
+	if c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML {
+		renderErr := c.Render("templates/error", fiber.Map{
+			"Title":     http.StatusText(status),
+			"Status":    status,
+			"Message":   appErr.Message,
+			"RequestID": requestID,
+		})
+		if renderErr == nil {
+			return nil
+		}
+		logging.From(c).Error("failed to render error page", "error", renderErr)
+	}
+	return c.JSON(fiber.Map{
+		"error":      appErr.Message,
+		"status":     status,
+		"request_id": requestID,
+	})
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DevonFarm/sales/auth"
+	"github.com/DevonFarm/sales/config"
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/health"
+	"github.com/DevonFarm/sales/storage"
+)
+
+// readinessChecks lists the dependencies an instance needs before it should
+// receive traffic.
+func readinessChecks(db *database.DB, stytch *auth.StytchAuth, store storage.Store, cfg config.HealthConfig) []health.Check {
+	checks := []health.Check{
+		{Name: "database", Run: db.Ping},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			return checkMigrations(ctx, db)
+		}},
+		{Name: "storage", Run: store.Ping},
+	}
+	if cfg.CheckAuth {
+		checks = append(checks, health.Check{Name: "auth", Run: stytch.Ping})
+	}
+	return checks
+}
+
+// checkMigrations fails until the schema is at least as new as the newest
+// migration shipped with this build.
+func checkMigrations(ctx context.Context, db *database.DB) error {
+	want, err := database.LatestMigration()
+	if err != nil {
+		return err
+	}
+	have, dirty, err := db.MigrationVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", have)
+	}
+	if have < want {
+		return fmt.Errorf("schema is at version %d, want %d", have, want)
+	}
+	return nil
+}
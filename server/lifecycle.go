@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Worker is a long running background task such as an email sender or
+// thumbnailer. Run must return promptly once ctx is cancelled.
+type Worker interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// WorkerFunc adapts a plain function to the Worker interface.
+type WorkerFunc struct {
+	WorkerName string
+	Fn         func(ctx context.Context) error
+}
+
+func (w WorkerFunc) Name() string {
+	return w.WorkerName
+}
+
+func (w WorkerFunc) Run(ctx context.Context) error {
+	return w.Fn(ctx)
+}
+
+// AddWorker registers a worker to be started by Run. It must be called
+// before Run.
+func (s *Server) AddWorker(w Worker) {
+	s.workers = append(s.workers, w)
+}
+
+// Run serves HTTP and runs the registered workers until SIGINT or SIGTERM.
+// On shutdown it stops accepting requests and drains in-flight ones, then
+// stops the workers, and only then closes the database.
+func (s *Server) Run() error {
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger := slog.With("worker", w.Name())
+			logger.Info("worker started")
+			if err := w.Run(workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("worker stopped with error", "error", err)
+				return
+			}
+			logger.Info("worker stopped")
+		}()
+	}
+
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- s.App.Listen(s.Config.ListenAddr)
+	}()
+
+	var err error
+	select {
+	case err = <-listenErr:
+		if err != nil {
+			err = fmt.Errorf("server stopped: %w", err)
+		}
+	case <-sigCtx.Done():
+		slog.Info("shutting down")
+	}
+	timeout := s.Config.ShutdownTimeout
+	if shutdownErr := s.App.ShutdownWithTimeout(timeout); shutdownErr != nil {
+		slog.Error("failed to drain requests", "error", shutdownErr)
+	}
+
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// Closing the pool would block on connections the stuck workers
+		// still hold, so leave it to process exit
+		slog.Error("workers did not stop in time, not closing database", "timeout", timeout)
+		return err
+	}
+
+	s.DB.Close()
+	return err
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/DevonFarm/sales/apperr"
+)
+
+// localURLPrefix is where the local backend serves signed files
+const localURLPrefix = "/files/"
+
+// Local stores blobs on the local filesystem and serves them itself, from
+// /files, to holders of a signed URL. It suits development and single
+// instance deployments.
+type Local struct {
+	dir        string
+	signingKey []byte
+}
+
+func NewLocal(dir, signingKey string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	key := []byte(signingKey)
+	if signingKey == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		slog.Warn("no storage signing key set, file URLs will stop working on restart")
+	}
+	return &Local{dir: dir, signingKey: key}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	// Write to a temporary file first so readers never see half a file
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (l *Local) Get(_ context.Context, key string) (*Object, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat %s: %w", key, err)
+	}
+	return &Object{
+		Body:        f,
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		Size:        info.Size(),
+	}, nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (l *Local) SignedURL(_ context.Context, key string, ttl time.Duration, downloadName string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	if downloadName != "" {
+		q.Set("name", downloadName)
+	}
+	q.Set("signature", l.sign(key, expires, downloadName))
+	return localURLPrefix + key + "?" + q.Encode(), nil
+}
+
+func (l *Local) Ping(context.Context) error {
+	if _, err := os.Stat(l.dir); err != nil {
+		return fmt.Errorf("storage directory unavailable: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) sign(key, expires, downloadName string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	// NUL cannot appear in any of the parts, so they cannot run together
+	mac.Write([]byte(key + "\x00" + expires + "\x00" + downloadName))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// serve answers GET /files/<key> for URLs made by SignedURL.
+func (l *Local) serve(c *fiber.Ctx) error {
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return apperr.NotFound("file not found")
+	}
+	expires := c.Query("expires")
+	downloadName := c.Query("name")
+	want := l.sign(key, expires, downloadName)
+	if !hmac.Equal([]byte(want), []byte(c.Query("signature"))) {
+		return apperr.Forbidden("invalid file link")
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return apperr.Forbidden("this file link has expired")
+	}
+
+	obj, err := l.Get(c.UserContext(), key)
+	if errors.Is(err, ErrNotFound) {
+		return apperr.NotFound("file not found")
+	}
+	if err != nil {
+		return apperr.Internal("failed to open file", err)
+	}
+	if obj.ContentType != "" {
+		c.Set(fiber.HeaderContentType, obj.ContentType)
+	}
+	if downloadName != "" {
+		c.Attachment(downloadName)
+	}
+	// Links expire, so only let the browser keep the file until then
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", max(exp-time.Now().Unix(), 0)))
+	return c.SendStream(obj.Body, int(obj.Size))
+}
+
+// RegisterRoutes mounts GET /files/* when the store is served locally; S3
+// signed URLs point straight at the bucket instead.
+func RegisterRoutes(app *fiber.App, store Store) {
+	if l, ok := store.(*Local); ok {
+		app.Get(localURLPrefix+"*", l.serve)
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/DevonFarm/sales/apperr"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "test-signing-key")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	return l
+}
+
+// newFileServer mounts store the way the server does, turning app errors
+// into their status codes.
+func newFileServer(store Store) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.SendStatus(apperr.As(err).StatusCode())
+		},
+	})
+	RegisterRoutes(app, store)
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, target string) (int, string, http.Header) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("GET %s: %v", target, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	return resp.StatusCode, string(body), resp.Header
+}
+
+func TestLocalStore(t *testing.T) {
+	testStore(t, newTestLocal(t))
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t)
+	app := newFileServer(l)
+	const key, body = "docs/coggins.pdf", "negative"
+	if err := l.Put(ctx, key, strings.NewReader(body), int64(len(body)), ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	signed, err := l.SignedURL(ctx, key, time.Hour, "coggins-2026.pdf")
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	status, got, header := get(t, app, signed)
+	if status != fiber.StatusOK || got != body {
+		t.Fatalf("GET signed URL = %d %q, want 200 %q", status, got, body)
+	}
+	if cd := header.Get(fiber.HeaderContentDisposition); !strings.Contains(cd, "attachment") || !strings.Contains(cd, "coggins-2026.pdf") {
+		t.Errorf("Content-Disposition = %q, want an attachment named coggins-2026.pdf", cd)
+	}
+	if cc := header.Get(fiber.HeaderCacheControl); !strings.HasPrefix(cc, "private, max-age=") {
+		t.Errorf("Cache-Control = %q, want a private max-age", cc)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parsing signed URL: %v", err)
+	}
+	tamper := func(path string, edit func(q url.Values)) string {
+		q := u.Query()
+		edit(q)
+		return path + "?" + q.Encode()
+	}
+	cases := map[string]string{
+		"no signature":    tamper(u.Path, func(q url.Values) { q.Del("signature") }),
+		"bad signature":   tamper(u.Path, func(q url.Values) { q.Set("signature", strings.Repeat("0", 64)) }),
+		"other key":       tamper("/files/docs/other.pdf", func(url.Values) {}),
+		"renamed":         tamper(u.Path, func(q url.Values) { q.Set("name", "evil.html") }),
+		"name dropped":    tamper(u.Path, func(q url.Values) { q.Del("name") }),
+		"expiry extended": tamper(u.Path, func(q url.Values) { q.Set("expires", "9999999999") }),
+	}
+	for name, target := range cases {
+		t.Run(name, func(t *testing.T) {
+			if status, _, _ := get(t, app, target); status != fiber.StatusForbidden {
+				t.Errorf("GET = %d, want 403", status)
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		expired, err := l.SignedURL(ctx, key, -time.Minute, "")
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		if status, _, _ := get(t, app, expired); status != fiber.StatusForbidden {
+			t.Errorf("GET expired URL = %d, want 403", status)
+		}
+	})
+
+	t.Run("other signing key", func(t *testing.T) {
+		other, err := NewLocal(t.TempDir(), "another-key")
+		if err != nil {
+			t.Fatalf("NewLocal: %v", err)
+		}
+		forged, err := other.SignedURL(ctx, key, time.Hour, "")
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		if status, _, _ := get(t, app, forged); status != fiber.StatusForbidden {
+			t.Errorf("GET URL signed with another key = %d, want 403", status)
+		}
+	})
+
+	t.Run("no download name", func(t *testing.T) {
+		inline, err := l.SignedURL(ctx, key, time.Hour, "")
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		status, _, header := get(t, app, inline)
+		if status != fiber.StatusOK {
+			t.Fatalf("GET = %d, want 200", status)
+		}
+		if cd := header.Get(fiber.HeaderContentDisposition); cd != "" {
+			t.Errorf("Content-Disposition = %q, want none", cd)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		missing, err := l.SignedURL(ctx, "docs/missing.pdf", time.Hour, "")
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		if status, _, _ := get(t, app, missing); status != fiber.StatusNotFound {
+			t.Errorf("GET missing file = %d, want 404", status)
+		}
+	})
+}
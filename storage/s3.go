@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/DevonFarm/sales/config"
+)
+
+// S3 stores blobs in a bucket on AWS S3 or an S3-compatible server such as
+// MinIO. The bucket should not allow public reads; files are handed out
+// through presigned URLs.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3(cfg config.S3Config) (*S3, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	lookup := minio.BucketLookupAuto
+	if cfg.UsePathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+		Transport:    otelhttp.NewTransport(http.DefaultTransport),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	// GetObject is lazy; Stat makes the request and surfaces a missing key
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	return &Object{Body: obj, ContentType: info.ContentType, Size: info.Size}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) SignedURL(ctx context.Context, key string, ttl time.Duration, downloadName string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	if downloadName != "" {
+		params.Set("response-content-disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, ttl, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign url for %s: %w", key, err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3) Ping(ctx context.Context) error {
+	ok, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to reach s3: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
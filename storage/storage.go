@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/DevonFarm/sales/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Object is a stored blob being read. Callers must close Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// Store keeps uploaded files such as horse photos and documents. Keys are
+// slash separated paths like "horses/<id>/images/<id>.jpg".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that lets anyone holding it fetch the object
+	// until ttl has passed. A non-empty downloadName makes browsers save
+	// the file under that name instead of displaying it.
+	SignedURL(ctx context.Context, key string, ttl time.Duration, downloadName string) (string, error)
+	// Ping checks that the backend is reachable
+	Ping(ctx context.Context) error
+}
+
+// New returns the Store for the configured backend.
+func New(cfg config.StorageConfig) (Store, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocal(cfg.LocalDir, cfg.SigningKey)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+func validateKey(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
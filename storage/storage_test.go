@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testStore runs the behaviour every Store must share against s.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	key := "test/" + t.Name() + "/hello.txt"
+	const body = "hello, horses"
+
+	if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	obj, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(obj.Body)
+	obj.Body.Close()
+	if err != nil {
+		t.Fatalf("reading object: %v", err)
+	}
+	if string(got) != body {
+		t.Errorf("Get body = %q, want %q", got, body)
+	}
+	if obj.Size != int64(len(body)) {
+		t.Errorf("Get size = %d, want %d", obj.Size, len(body))
+	}
+	if !strings.HasPrefix(obj.ContentType, "text/plain") {
+		t.Errorf("Get content type = %q, want text/plain", obj.ContentType)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	// Deleting twice is not an error
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+
+	for _, bad := range []string{"", ".", "../escape", "/absolute", "a//b"} {
+		if err := s.Put(ctx, bad, strings.NewReader(body), int64(len(body)), ""); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", bad)
+		}
+		if _, err := s.SignedURL(ctx, bad, 0, ""); err == nil {
+			t.Errorf("SignedURL(%q) succeeded, want an invalid key error", bad)
+		}
+	}
+
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
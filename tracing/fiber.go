@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for each request, continuing any trace
+// the caller propagated. Handlers must pass c.UserContext() on to the
+// database and outbound calls for their spans to nest under it. It must be
+// mounted outside the logging middleware so the final status is known.
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(tracerName)
+	return func(c *fiber.Ctx) error {
+		carrier := propagation.HeaderCarrier(http.Header(c.GetReqHeaders()))
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+		ctx, span := tracer.Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Method()),
+				semconv.URLPath(c.Path()),
+				semconv.ClientAddress(c.IP()),
+				semconv.UserAgentOriginal(c.Get(fiber.HeaderUserAgent)),
+			),
+		)
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		route := c.Route().Path
+		status := c.Response().StatusCode()
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(status),
+		)
+		if requestID, ok := c.Locals("requestid").(string); ok {
+			span.SetAttributes(attribute.String("request_id", requestID))
+		}
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		return err
+	}
+}
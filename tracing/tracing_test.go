@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DevonFarm/sales/config"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.TracingConfig
+		wantErr bool
+	}{
+		{name: "none", cfg: config.TracingConfig{Exporter: "none", ServiceName: "test"}},
+		{name: "stdout", cfg: config.TracingConfig{Exporter: "stdout", ServiceName: "test"}},
+		// The exporter connects lazily, so no collector needs to be running
+		{name: "otlp", cfg: config.TracingConfig{Exporter: "otlp", OTLPEndpoint: "http://localhost:4318", ServiceName: "test"}},
+		{name: "unknown", cfg: config.TracingConfig{Exporter: "jaeger"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			shutdown, err := Setup(ctx, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := shutdown(ctx); err != nil {
+				t.Errorf("shutdown: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/jobs"
+	"github.com/DevonFarm/sales/mail"
+)
+
+const WelcomeEmailJob = "user.welcome_email"
+
+type welcomeEmail struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// RegisterJobs registers the handlers for the user package's jobs.
+func RegisterJobs(q *jobs.Queue, db *database.DB, mailer *mail.Mailer) {
+	q.Handle(WelcomeEmailJob, sendWelcomeEmail(db, mailer))
+}
+
+// EnqueueWelcomeEmail queues the welcome email for a newly created user. It
+// is only ever sent once per user.
+func EnqueueWelcomeEmail(ctx context.Context, db jobs.Execer, u *User) error {
+	return jobs.Enqueue(ctx, db, WelcomeEmailJob, "welcome:"+u.ID.String(), welcomeEmail{UserID: u.ID})
+}
+
+func sendWelcomeEmail(db *database.DB, mailer *mail.Mailer) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var p welcomeEmail
+		if err := job.Decode(&p); err != nil {
+			return err
+		}
+		u, err := GetUser(ctx, db, p.UserID.String())
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			// Deleted their account before we got to it
+			return nil
+		}
+		body := fmt.Sprintf(
+			"Hi %s,\n\nWelcome to Devon Farm Sales. Once you have signed in you can "+
+				"create your farm and start adding your horses.\n",
+			u.Name,
+		)
+		return mailer.Send(ctx, u.Email, "Welcome to Devon Farm Sales", body)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/DevonFarm/sales/apperr"
+	"github.com/DevonFarm/sales/audit"
 	"github.com/DevonFarm/sales/database"
 )
 
-func RegisterRoutes(app *fiber.App, db *database.DB, authMiddleware fiber.Handler) {
-	userGroup := app.Group("/user/:id", authMiddleware)
+// RegisterRoutes mounts the profile pages. The middleware must load the
+// session user into Locals, as auth.RequireUser does.
+func RegisterRoutes(app *fiber.App, db *database.DB, middleware ...fiber.Handler) {
+	userGroup := app.Group("/user/:id", middleware...)
 	userGroup.Get("/profile", getProfile(db))
 	userGroup.Post("/profile", updateProfile(db))
 }
@@ -19,15 +23,18 @@ func getProfile(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		userID := c.Params("id")
 		if userID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user ID is required"})
+			return apperr.Validation("user ID is required")
+		}
+		if !isSessionUser(c, userID) {
+			return apperr.NotFound("user not found")
 		}
 
-		user, err := GetUser(c.Context(), db, userID)
+		user, err := GetUser(c.UserContext(), db, userID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get user"})
+			return apperr.Internal("failed to get user", err)
 		}
 		if user == nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+			return apperr.NotFound("user not found")
 		}
 
 		return c.Render("templates/profile", fiber.Map{
@@ -41,21 +48,25 @@ func updateProfile(db *database.DB) func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		userID := c.Params("id")
 		if userID == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user ID is required"})
+			return apperr.Validation("user ID is required")
+		}
+		if !isSessionUser(c, userID) {
+			return apperr.NotFound("user not found")
 		}
 
 		// Get existing user
-		user, err := GetUser(c.Context(), db, userID)
+		user, err := GetUser(c.UserContext(), db, userID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to get user"})
+			return apperr.Internal("failed to get user", err)
 		}
 		if user == nil {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+			return apperr.NotFound("user not found")
 		}
 
 		// Get specific form values to avoid overwriting unintended fields
 		name := c.FormValue("name")
 		email := c.FormValue("email")
+		oldName, oldEmail := user.Name, user.Email
 		if name != "" {
 			user.Name = name
 		}
@@ -64,13 +75,29 @@ func updateProfile(db *database.DB) func(*fiber.Ctx) error {
 		}
 
 		// Save updated user
-		if err := user.Update(c.Context(), db); err != nil {
+		if err := user.Update(c.UserContext(), db); err != nil {
 			return c.Status(fiber.StatusInternalServerError).Render("templates/profile", fiber.Map{
 				"Title": "Edit Profile",
 				"User":  user,
 				"Error": "Failed to update profile",
 			})
 		}
+		if user.Name != oldName {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionProfileUpdated,
+				UserID: user.ID,
+				FarmID: user.FarmID,
+				Detail: fmt.Sprintf("name changed from %q to %q", oldName, user.Name),
+			})
+		}
+		if user.Email != oldEmail {
+			audit.Record(c, db, audit.Event{
+				Action: audit.ActionEmailChanged,
+				UserID: user.ID,
+				FarmID: user.FarmID,
+				Detail: fmt.Sprintf("email changed from %s to %s", oldEmail, user.Email),
+			})
+		}
 
 		// Redirect to farm dashboard if user has a farm, otherwise to farm creation
 		if user.FarmID == uuid.Nil {
@@ -79,3 +106,11 @@ func updateProfile(db *database.DB) func(*fiber.Ctx) error {
 		return c.Redirect(fmt.Sprintf("/farm/%s", user.FarmID))
 	}
 }
+
+// isSessionUser reports whether userID is the user the request acts as.
+// Other users' profiles are reported as not found rather than forbidden so
+// the routes don't reveal which IDs exist.
+func isSessionUser(c *fiber.Ctx, userID string) bool {
+	u, ok := c.Locals("user").(*User)
+	return ok && u != nil && u.ID.String() == userID
+}
@@ -3,11 +3,13 @@ package user
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 
 	"github.com/DevonFarm/sales/database"
+	"github.com/DevonFarm/sales/metrics"
 )
 
 type User struct {
@@ -16,16 +18,32 @@ type User struct {
 	Email    string    `db:"email" form:"email"`
 	FarmID   uuid.UUID `db:"farm_id" form:"-"`
 	StytchID string    `db:"stytch_id" form:"-"`
+	IsAdmin  bool      `db:"is_admin" form:"-"`
+	// DisabledAt is set when an admin has disabled the account
+	DisabledAt *time.Time `db:"disabled_at" form:"-"`
+}
+
+// userColumns lists the columns scanned into a User by name
+const userColumns = `id, name, email, farm_id, stytch_id, is_admin, disabled_at`
+
+func (u *User) HasFarm() bool {
+	return u.FarmID != uuid.Nil
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
 }
 
 func GetUser(ctx context.Context, db *database.DB, userID string) (*User, error) {
+	defer metrics.TimeQuery("user.GetUser")()
+
 	uid, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 	rows, err := db.Query(
 		ctx,
-		`SELECT id, name, email, farm_id, stytch_id FROM users WHERE id = $1`,
+		`SELECT `+userColumns+` FROM users WHERE id = $1`,
 		uid,
 	)
 	if err != nil {
@@ -54,9 +72,11 @@ func NewUser(ctx context.Context, db *database.DB, name, email, stytchID string)
 }
 
 func GetUserByStytchID(ctx context.Context, db *database.DB, stytchID string) (*User, error) {
+	defer metrics.TimeQuery("user.GetUserByStytchID")()
+
 	rows, err := db.Query(
 		ctx,
-		`SELECT id, name, email, farm_id, stytch_id FROM users WHERE stytch_id = $1`,
+		`SELECT `+userColumns+` FROM users WHERE stytch_id = $1`,
 		stytchID,
 	)
 	if err != nil {
@@ -72,7 +92,49 @@ func GetUserByStytchID(ctx context.Context, db *database.DB, stytchID string) (*
 	return &user, nil
 }
 
+func GetUserByEmail(ctx context.Context, db *database.DB, email string) (*User, error) {
+	defer metrics.TimeQuery("user.GetUserByEmail")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE email = $1`,
+		email,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user by email: %w", err)
+	}
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[User])
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return &user, nil
+}
+
+// GetUsersByFarmID returns the members of a farm who can still sign in.
+func GetUsersByFarmID(ctx context.Context, db *database.DB, farmID uuid.UUID) ([]*User, error) {
+	defer metrics.TimeQuery("user.GetUsersByFarmID")()
+
+	rows, err := db.Query(
+		ctx,
+		`SELECT `+userColumns+` FROM users WHERE farm_id = $1 AND disabled_at IS NULL ORDER BY name`,
+		farmID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users by farm_id: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByName[User])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by farm_id: %w", err)
+	}
+	return users, nil
+}
+
 func (u *User) Save(ctx context.Context, db *database.DB) error {
+	defer metrics.TimeQuery("user.Save")()
+
 	if u.ID != uuid.Nil {
 		return fmt.Errorf("user already has an ID, use Update() method instead")
 	}
@@ -86,10 +148,16 @@ func (u *User) Save(ctx context.Context, db *database.DB) error {
 		u.FarmID,   // $4
 		uuid.Nil,   // $5
 	)
-	return row.Scan(&u.ID)
+	if err := row.Scan(&u.ID); err != nil {
+		return err
+	}
+	metrics.UsersCreated.Inc()
+	return nil
 }
 
 func (u *User) Update(ctx context.Context, db *database.DB) error {
+	defer metrics.TimeQuery("user.Update")()
+
 	if u.ID == uuid.Nil {
 		return fmt.Errorf("user has no ID, use Save() method instead")
 	}
@@ -108,3 +176,25 @@ func (u *User) Update(ctx context.Context, db *database.DB) error {
 	}
 	return nil
 }
+
+// SetDisabled disables or re-enables the account. Disabled users cannot log
+// in or use an existing session.
+func (u *User) SetDisabled(ctx context.Context, db *database.DB, disabled bool) error {
+	defer metrics.TimeQuery("user.SetDisabled")()
+
+	if u.ID == uuid.Nil {
+		return fmt.Errorf("user has no ID, use Save() method instead")
+	}
+
+	row := db.QueryRow(
+		ctx,
+		`UPDATE users SET disabled_at = CASE WHEN $1 THEN now() ELSE NULL END, updated_at = now()
+		WHERE id = $2 RETURNING disabled_at`,
+		disabled, // $1
+		u.ID,     // $2
+	)
+	if err := row.Scan(&u.DisabledAt); err != nil {
+		return fmt.Errorf("failed to update user disabled state: %w", err)
+	}
+	return nil
+}